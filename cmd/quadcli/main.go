@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/c-bata/go-prompt"
 	"github.com/quadrille/quadrille/constants"
+	"github.com/quadrille/quadrille/core/ds"
 	httpClient "github.com/quadrille/quadrille/http/client"
 	"github.com/quadrille/quadrille/opt"
 	"os"
@@ -15,14 +17,36 @@ func completer(d prompt.Document) []prompt.Suggest {
 		return []prompt.Suggest{}
 	}
 	s := []prompt.Suggest{
-		{Text: "get", Description: "Retrieves a location by id"},
+		{Text: "get", Description: "Retrieves a location by id, with only the data keys listed by fields=<key,...> if given"},
 		{Text: "insert", Description: "Creates a new location"},
 		{Text: "update", Description: "Updates an existing location"},
 		{Text: "updateloc", Description: "Updates an existing location with new lat,long"},
 		{Text: "updatedata", Description: "Updates an existing location with new data"},
 		{Text: "del", Description: "Deletes an existing location"},
 		{Text: "neighbors", Description: "Get nearby locations"},
+		{Text: "nearest", Description: "Get the k nearest locations"},
+		{Text: "within", Description: "Get locations within a bounding box"},
+		{Text: "aggregate", Description: "Counts locations, and optionally sums a numeric data field, per grid cell of a bounding box"},
+		{Text: "cluster", Description: "Groups the locations of a viewport into clusters for a map zoom level"},
+		{Text: "geohash", Description: "Get locations within a geohash"},
+		{Text: "matrix", Description: "Get the distances from each origin to each destination, given as location ids or lat,lon"},
+		{Text: "corridor", Description: "Get locations within a buffer of a route, ordered along the route"},
+		{Text: "polygon", Description: "Get locations within a GeoJSON Polygon or MultiPolygon"},
+		{Text: "count", Description: "Counts the matches of a neighbors, within or polygon query, up to its limit if given"},
+		{Text: "setgeofence", Description: "Creates or replaces a circular or GeoJSON polygon geofence"},
+		{Text: "getgeofence", Description: "Retrieves a geofence by id"},
+		{Text: "delgeofence", Description: "Deletes an existing geofence"},
+		{Text: "geofences", Description: "Lists all geofences"},
+		{Text: "setshape", Description: "Creates or replaces a GeoJSON polygon or line shape, such as a service area or road segment"},
+		{Text: "getshape", Description: "Retrieves a shape by id"},
+		{Text: "delshape", Description: "Deletes an existing shape"},
+		{Text: "nearshapes", Description: "Get the shapes within a radius of a lat,lon"},
+		{Text: "containing", Description: "Get the polygon shapes containing a lat,lon, with their data if followed by `data`"},
+		{Text: "geofenceevents", Description: "Lists geofence enter/exit/dwell events after a sequence number"},
+		{Text: "sethistory", Description: "Retains the given number of recent positions of a location, 0 to disable"},
+		{Text: "trajectory", Description: "Get the positions and distance travelled by a location between two unix millisecond times"},
 		{Text: "members", Description: "Lists all replica members"},
+		{Text: "stats", Description: "Displays the number of nodes, locations, the depth and the bounds of the quadtree"},
 		{Text: "leader", Description: "Displays the leader address"},
 		{Text: "isleader", Description: "Returns true if connected instance is a leader. False otherwise"},
 		{Text: "join", Description: "Joins an existing cluster"},
@@ -45,9 +69,23 @@ func showStartMsg(service opt.QuadrilleService) {
 	}
 }
 
+//Validates coordinates against the bounds of the node when it holds planar coordinates
+func useServerBounds(service opt.QuadrilleService) {
+	resp, err := service.Stats()
+	if err != nil {
+		return
+	}
+	var stats ds.TreeStats
+	if err := json.Unmarshal([]byte(resp), &stats); err != nil || !stats.Planar {
+		return
+	}
+	opt.SetWorldBounds(stats.Bounds[0], stats.Bounds[1], stats.Bounds[2], stats.Bounds[3])
+}
+
 func main() {
 	quadrilleService := prepareQuadrilleHttpService()
 	showStartMsg(quadrilleService)
+	useServerBounds(quadrilleService)
 	history := make([]string, 0)
 	//Below is added to fix an issue with go-prompt library
 	defer handleExit()
@@ -0,0 +1,179 @@
+package ds
+
+import (
+	"sort"
+	"strings"
+)
+
+//GridCell holds the aggregates of the locations within a cell of the tree.
+//Sum and Avg are only set when a field was aggregated and at least one location in the cell had a numeric value for it.
+type GridCell struct {
+	MinLat  float64  `json:"minLat"`
+	MinLong float64  `json:"minLon"`
+	MaxLat  float64  `json:"maxLat"`
+	MaxLong float64  `json:"maxLon"`
+	Count   int      `json:"count"`
+	Sum     *float64 `json:"sum,omitempty"`
+	Avg     *float64 `json:"avg,omitempty"`
+}
+
+//Accumulates the locations of a single cell
+type cellAggregate struct {
+	bounds     Rectangle
+	count      int
+	sum        float64
+	valueCount int
+}
+
+func (c *cellAggregate) add(leaf *QuadTreeLeaf, fieldPath []string) {
+	c.count++
+	if fieldPath == nil {
+		return
+	}
+	if val, ok := getDataValue(leaf.Data, fieldPath); ok {
+		if num, ok := val.(float64); ok {
+			c.sum += num
+			c.valueCount++
+		}
+	}
+}
+
+func (c *cellAggregate) toGridCell() GridCell {
+	cell := GridCell{Count: c.count}
+	cell.MinLat, cell.MinLong, cell.MaxLat, cell.MaxLong = getBoxBounds(c.bounds)
+	if c.valueCount > 0 {
+		sum, avg := c.sum, c.sum/float64(c.valueCount)
+		cell.Sum, cell.Avg = &sum, &avg
+	}
+	return cell
+}
+
+//Aggregate counts the locations within the rectangle formed by the sw and ne corners per cell at the given depth,
+//the root being at depth 0 and each level splitting its parent into quadrants. Depths beyond the maximum depth of the tree are clamped.
+//If field, a dot separated path into the data, is not empty its numeric values are summed and averaged per cell.
+//Only cells containing locations are returned, ordered from south west to north east. A sw longitude greater than
+//the ne longitude denotes a box crossing the antimeridian.
+func (q *QuadTree) Aggregate(sw, ne Position, depth int, field string) []GridCell {
+	if depth > q.height {
+		depth = q.height
+	}
+	var fieldPath []string
+	if field != "" {
+		fieldPath = strings.Split(field, ".")
+	}
+	//A cell spanning the antimeridian is visited for both halves of a box crossing it, so cells are merged by bounds
+	cells := map[[4]float64]*cellAggregate{}
+	for _, box := range q.splitBox(sw, ne) {
+		q.forEachCellAtDepth(box, depth, func(bounds Rectangle, leaves []QuadTreeLeaf) {
+			minLat, minLong, maxLat, maxLong := getBoxBounds(bounds)
+			key := [4]float64{minLat, minLong, maxLat, maxLong}
+			cell, ok := cells[key]
+			if !ok {
+				cell = &cellAggregate{bounds: bounds}
+			}
+			for i := range leaves {
+				if isWithinBox(box, leaves[i].GetLocation()) {
+					cell.add(&leaves[i], fieldPath)
+				}
+			}
+			if cell.count > 0 {
+				cells[key] = cell
+			}
+		})
+	}
+
+	gridCells := make([]GridCell, 0, len(cells))
+	for _, cell := range cells {
+		gridCells = append(gridCells, cell.toGridCell())
+	}
+	sort.Slice(gridCells, func(i, j int) bool {
+		return isSouthWestOf(gridCells[i].MinLat, gridCells[i].MinLong, gridCells[j].MinLat, gridCells[j].MinLong)
+	})
+	return gridCells
+}
+
+//Visits the cells at depth, the root being at depth 0, which intersect the box and contain locations, along with
+//copies of the leaves within them. A cell is the node at depth, or where the tree was not split that deep, the
+//quadrant the node would have at depth, so that the cells do not depend on how densely the tree was populated.
+func (q *QuadTree) forEachCellAtDepth(box Rectangle, depth int, visit func(cell Rectangle, leaves []QuadTreeLeaf)) {
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	var walk func(node *QuadTreeNode)
+	walk = func(node *QuadTreeNode) {
+		if node.children != nil && node.depth < depth {
+			for _, child := range node.children {
+				if boxesIntersect(child.boundingBox, box) {
+					walk(child)
+				}
+			}
+			return
+		}
+		if node.depth == depth {
+			leaves := []QuadTreeLeaf{}
+			forEachLeaf(node, node.boundingBox, func(leaf *QuadTreeLeaf) {
+				leaves = append(leaves, *leaf)
+			})
+			if len(leaves) > 0 {
+				visit(node.boundingBox, leaves)
+			}
+			return
+		}
+		//Group the leaves of the unsplit node by the quadrant at depth containing them
+		cells := map[[4]float64]Rectangle{}
+		cellLeaves := map[[4]float64][]QuadTreeLeaf{}
+		forEachLeaf(node, node.boundingBox, func(leaf *QuadTreeLeaf) {
+			cell := node.boundingBox
+			for cellDepth := node.depth; cellDepth < depth; cellDepth++ {
+				cell = getContainingQuadrant(cell, leaf.GetLocation())
+			}
+			if !boxesIntersect(cell, box) {
+				return
+			}
+			minLat, minLong, maxLat, maxLong := getBoxBounds(cell)
+			key := [4]float64{minLat, minLong, maxLat, maxLong}
+			cells[key] = cell
+			cellLeaves[key] = append(cellLeaves[key], *leaf)
+		})
+		for key, cell := range cells {
+			visit(cell, cellLeaves[key])
+		}
+	}
+	walk(q.root)
+}
+
+//Returns the quadrant of the box containing the location, picked in the same order as findContainingChild
+func getContainingQuadrant(box Rectangle, location GeoLocation) Rectangle {
+	for _, quadrant := range box.GetQuadrants() {
+		if isWithinBox(quadrant, location) {
+			return quadrant
+		}
+	}
+	return box
+}
+
+//Visits the leaves under the node which lie within the box. The caller must hold a lock of the structure.
+func forEachLeaf(node *QuadTreeNode, box Rectangle, visit func(leaf *QuadTreeLeaf)) {
+	if node.leaves != nil {
+		node.leavesMtx.RLock()
+		defer node.leavesMtx.RUnlock()
+		for _, leaf := range *node.leaves {
+			if isWithinBox(box, leaf.GetLocation()) {
+				visit(leaf)
+			}
+		}
+	} else if node.children != nil {
+		for _, child := range node.children {
+			if boxesIntersect(child.boundingBox, box) {
+				forEachLeaf(child, box, visit)
+			}
+		}
+	}
+}
+
+//Orders cells from south west to north east by their south west corners
+func isSouthWestOf(lat1, long1, lat2, long2 float64) bool {
+	if lat1 != lat2 {
+		return lat1 < lat2
+	}
+	return long1 < long2
+}
@@ -0,0 +1,41 @@
+package ds
+
+import "math"
+
+//AltitudeQuery restricts a neighbour query to the locations within an altitude band, and may have it measure
+//distances in 3D. The zero value leaves the query unchanged.
+type AltitudeQuery struct {
+	Use3D  bool     //Whether distances include the difference in altitude from the queried location
+	MinAlt *float64 //Lowest altitude of the band in metres, unbounded if nil
+	MaxAlt *float64 //Highest altitude of the band in metres, unbounded if nil
+}
+
+//Returns a leafMatcher accepting the leaves accepted by matches which lie within the altitude band
+func (a AltitudeQuery) matcher(matches leafMatcher) leafMatcher {
+	if a.MinAlt == nil && a.MaxAlt == nil {
+		return matches
+	}
+	return func(leaf *QuadTreeLeaf) bool {
+		alt := leaf.Location.Alt()
+		if (a.MinAlt != nil && alt < *a.MinAlt) || (a.MaxAlt != nil && alt > *a.MaxAlt) {
+			return false
+		}
+		return matches(leaf)
+	}
+}
+
+//WithAltitude returns a model measuring the straight line distance between locations, combining the distance measured
+//by the model along the ground with the difference in their altitudes. The bounds to rectangles of the model still hold,
+//as the distance along the ground never exceeds the one including altitude.
+func WithAltitude(model DistanceModel) DistanceModel {
+	return altitudeModel{model}
+}
+
+type altitudeModel struct {
+	DistanceModel
+}
+
+func (m altitudeModel) Distance(location1, location2 GeoLocation) float64 {
+	distance := m.DistanceModel.Distance(location1, location2)
+	return math.Hypot(distance, location1.Alt()-location2.Alt())
+}
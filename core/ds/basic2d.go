@@ -1,32 +1,45 @@
 package ds
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
 
 type GeoLocation interface {
 	Lat() float64
 	Long() float64
-	DistanceTo(location GeoLocation) float64
-	IntersectsRectangle(Rectangle, int) bool
+	DistanceTo(location GeoLocation, model DistanceModel) float64
+	IntersectsRectangle(Rectangle, int, DistanceModel) bool
+	Alt() float64
 }
 
 type Position struct {
 	Latitude, Longitude float64
+	Altitude            float64 `json:",omitempty"` //Metres above sea level, 0 for locations without an altitude
 }
 
 func NewPosition(lat float64, long float64) *Position {
 	return &Position{Latitude: lat, Longitude: long}
 }
 
-func (p Position) IntersectsRectangle(r Rectangle, radiusInMetres int) bool {
-	nearestCorner := r.GetNearestCorner(p)
-	if DistanceOnEarth(p, nearestCorner) < float64(radiusInMetres) {
-		return true
-	}
-	return false
+func NewPositionWithAltitude(lat, long, alt float64) *Position {
+	return &Position{Latitude: lat, Longitude: long, Altitude: alt}
 }
 
-func (p Position) DistanceTo(location GeoLocation) float64 {
-	return DistanceOnEarth(p, location)
+//IntersectsRectangle returns true if any point of the rectangle may lie within radiusInMetres of the position as
+//measured by the model. A circle may cross an edge of the rectangle without containing any of its corners, so the
+//distance is measured to the nearest point of the rectangle rather than to its nearest corner.
+func (p Position) IntersectsRectangle(r Rectangle, radiusInMetres int, model DistanceModel) bool {
+	return model.MinDistanceToRectangle(p, r) <= float64(radiusInMetres)
+}
+
+func (p Position) IsWithin(r Rectangle) bool {
+	return isWithinBox(r, p)
+}
+
+//DistanceTo returns the distance to the location as measured by the model
+func (p Position) DistanceTo(location GeoLocation, model DistanceModel) float64 {
+	return model.Distance(p, location)
 }
 
 func (p Position) Lat() float64 {
@@ -37,6 +50,10 @@ func (p Position) Long() float64 {
 	return p.Longitude
 }
 
+func (p Position) Alt() float64 {
+	return p.Altitude
+}
+
 //func NewPosition(Latitude, Longitude float64) Position {
 //	return Position{Latitude, Longitude}
 //}
@@ -107,3 +124,92 @@ func (r rectangle) GetQuadrants() [4]Rectangle {
 	quad4 := NewRectangle(NewPosition(lat2, long2), mid)
 	return [4]Rectangle{quad1, quad2, quad3, quad4}
 }
+
+//Returns the rectangles covering the box from the sw to the ne corner. A box whose west edge is east of
+//its east edge crosses the antimeridian, so it is split there into a western and an eastern part.
+func splitAtAntimeridian(sw, ne GeoLocation) []Rectangle {
+	if sw.Long() <= ne.Long() {
+		return []Rectangle{NewRectangle(sw, ne)}
+	}
+	return []Rectangle{
+		NewRectangle(sw, NewPosition(ne.Lat(), 180)),
+		NewRectangle(NewPosition(sw.Lat(), -180), ne),
+	}
+}
+
+//Returns the center of the box from the sw to the ne corner, which may cross the antimeridian
+func getBoxCenter(sw, ne GeoLocation) GeoLocation {
+	eastLong := ne.Long()
+	if sw.Long() > eastLong {
+		eastLong += 360
+	}
+	midLong := (sw.Long() + eastLong) / 2
+	if midLong > 180 {
+		midLong -= 360
+	}
+	return NewPosition((sw.Lat()+ne.Lat())/2, midLong)
+}
+
+func boxesIntersectAny(boxes []Rectangle, box Rectangle) bool {
+	for _, b := range boxes {
+		if boxesIntersect(b, box) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWithinAnyBox(boxes []Rectangle, location GeoLocation) bool {
+	for _, box := range boxes {
+		if isWithinBox(box, location) {
+			return true
+		}
+	}
+	return false
+}
+
+//Returns the shortest distance in metres from the location to any point of the rectangle, 0 if it lies inside.
+//Distances are measured on the sphere, so they wrap across the antimeridian and over the poles.
+//When the location is outside the longitudinal span of the rectangle the nearest point lies on one of its
+//meridian edges, at the latitude where the meridian is closest to the location, clamped to the edge.
+func minDistanceToRectangle(location GeoLocation, r Rectangle) float64 {
+	minLat, minLong, maxLat, maxLong := getBoxBounds(r)
+	lat, long := location.Lat(), location.Long()
+	if long >= minLong && long <= maxLong {
+		return DistanceOnEarth(location, NewPosition(math.Max(minLat, math.Min(maxLat, lat)), long))
+	}
+	nearest := math.Inf(1)
+	for _, edgeLong := range [2]float64{minLong, maxLong} {
+		edgeLat := nearestLatOnMeridian(lat, long, edgeLong)
+		edgeLat = math.Max(minLat, math.Min(maxLat, edgeLat))
+		nearest = math.Min(nearest, DistanceOnEarth(location, NewPosition(edgeLat, edgeLong)))
+	}
+	return nearest
+}
+
+//Returns the shortest distance in metres from a location within the rectangle to its boundary.
+//The nearest point of a parallel edge lies on the meridian of the location, while the nearest point
+//of a meridian edge is found as in minDistanceToRectangle.
+func minDistanceToBoxEdge(location GeoLocation, r Rectangle) float64 {
+	minLat, minLong, maxLat, maxLong := getBoxBounds(r)
+	lat, long := location.Lat(), location.Long()
+	nearest := math.Min(DistanceOnEarth(location, NewPosition(minLat, long)), DistanceOnEarth(location, NewPosition(maxLat, long)))
+	for _, edgeLong := range [2]float64{minLong, maxLong} {
+		edgeLat := math.Max(minLat, math.Min(maxLat, nearestLatOnMeridian(lat, long, edgeLong)))
+		nearest = math.Min(nearest, DistanceOnEarth(location, NewPosition(edgeLat, edgeLong)))
+	}
+	return nearest
+}
+
+//Returns the latitude of the point on the meridian at meridianLong which is closest to lat,long
+func nearestLatOnMeridian(lat, long, meridianLong float64) float64 {
+	cosDLong := math.Cos((meridianLong - long) * math.Pi / 180)
+	if cosDLong <= 0 {
+		//The meridian lies on the far side of the globe, so its nearest point is the pole on our hemisphere
+		if lat < 0 {
+			return -90
+		}
+		return 90
+	}
+	return math.Atan(math.Tan(lat*math.Pi/180)/cosDLong) * 180 / math.Pi
+}
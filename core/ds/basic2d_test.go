@@ -8,7 +8,7 @@ func TestBasic2D(t *testing.T) {
 	location1 := NewPosition(90, 180)
 	location2 := NewPosition(0, 0)
 
-	distanceInMetres := location1.DistanceTo(location2)
+	distanceInMetres := location1.DistanceTo(location2, Haversine)
 	expected := 10007543
 	if int(distanceInMetres) != expected {
 		t.Fatalf("DistanceTo: Expected:%d, Got:%d", expected, int(distanceInMetres))
@@ -22,8 +22,17 @@ func TestBasic2D(t *testing.T) {
 		t.Fatalf("GetNearestCorner: Expected %f,%f, Got %f,%f", expectedLat, expectedLong, nearestCorner.Lat(), nearestCorner.Long())
 	}
 
-	intersects := location1.IntersectsRectangle(rect, (expected/2)+1)
+	intersects := location1.IntersectsRectangle(rect, (expected/2)+1, Haversine)
 	if !intersects {
 		t.Fatalf("IntersectsRectangle: expected:%v, got:%v", true, intersects)
 	}
+
+	//Planar coordinates are metres, so the corner at 3,4 lies 5m from the origin
+	planarDistance := NewPosition(0, 0).DistanceTo(NewPosition(3, 4), Planar)
+	if planarDistance != 5 {
+		t.Fatalf("DistanceTo: Expected:%d, Got:%f", 5, planarDistance)
+	}
+	if NewPosition(0, 0).IntersectsRectangle(NewRectangle(NewPosition(3, 4), NewPosition(10, 10)), 4, Planar) {
+		t.Fatalf("IntersectsRectangle: expected:%v, got:%v", false, true)
+	}
 }
@@ -0,0 +1,66 @@
+package ds
+
+import (
+	"sort"
+)
+
+//Number of tree levels between a map zoom level and the depth of the nodes used as clusters.
+//A tile at zoom z spans a node at depth z, so each tile is split into 4x4 clusters.
+const clusterDepthOffset = 2
+
+//Cluster summarises the locations within a cell of the tree
+type Cluster struct {
+	Lat       float64  `json:"lat"` //Centroid of the locations
+	Long      float64  `json:"lon"`
+	Count     int      `json:"count"`
+	SampleIDs []string `json:"sampleIDs"` //Lexicographically smallest location ids in the cluster
+	MinLat    float64  `json:"minLat"`
+	MinLong   float64  `json:"minLon"`
+	MaxLat    float64  `json:"maxLat"`
+	MaxLong   float64  `json:"maxLon"`
+}
+
+//Returns the depth of the nodes used as clusters at the map zoom level
+func (q *QuadTree) clusterDepth(zoom int) int {
+	depth := zoom + clusterDepthOffset
+	if depth < 0 {
+		return 0
+	}
+	if depth > q.height {
+		return q.height
+	}
+	return depth
+}
+
+//GetClusters groups the locations per cell at the depth for the zoom level, returning the clusters whose
+//cell intersects the viewport formed by the sw and ne corners. Clusters are computed over their whole cell rather
+//than the part within the viewport, so that a cluster does not change as the viewport is panned. A sw longitude
+//greater than the ne longitude denotes a viewport crossing the antimeridian.
+func (q *QuadTree) GetClusters(sw, ne Position, zoom, sampleSize int) []Cluster {
+	clusters := []Cluster{}
+	visit := func(cell Rectangle, leaves []QuadTreeLeaf) {
+		var sumLat, sumLong float64
+		locationIDs := []string{}
+		for _, leaf := range leaves {
+			sumLat += leaf.GetLocation().Lat()
+			sumLong += leaf.GetLocation().Long()
+			locationIDs = append(locationIDs, leaf.GetLocationID())
+		}
+		count := len(locationIDs)
+		cluster := Cluster{Lat: sumLat / float64(count), Long: sumLong / float64(count), Count: count}
+		sort.Strings(locationIDs)
+		if count > sampleSize {
+			locationIDs = locationIDs[:sampleSize]
+		}
+		cluster.SampleIDs = locationIDs
+		cluster.MinLat, cluster.MinLong, cluster.MaxLat, cluster.MaxLong = getBoxBounds(cell)
+		clusters = append(clusters, cluster)
+	}
+	for _, box := range q.splitBox(sw, ne) {
+		q.forEachCellAtDepth(box, q.clusterDepth(zoom), visit)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return isSouthWestOf(clusters[i].MinLat, clusters[i].MinLong, clusters[j].MinLat, clusters[j].MinLong)
+	})
+	return clusters
+}
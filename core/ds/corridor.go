@@ -0,0 +1,157 @@
+package ds
+
+import (
+	"encoding/json"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"math"
+	"sort"
+)
+
+//CorridorResult is a location within the buffer of a route
+type CorridorResult struct {
+	QuadTreeNeighborResult
+	DistanceAlongRoute float64 `json:"DistanceAlongRoute"` //Metres from the start of the route to the point of the route nearest to the location
+}
+
+type byDistanceAlongRoute []CorridorResult
+
+func (d byDistanceAlongRoute) Len() int {
+	return len(d)
+}
+
+func (d byDistanceAlongRoute) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+}
+
+func (d byDistanceAlongRoute) Less(i, j int) bool {
+	if d[i].DistanceAlongRoute != d[j].DistanceAlongRoute {
+		return d[i].DistanceAlongRoute < d[j].DistanceAlongRoute
+	}
+	return d[i].Distance < d[j].Distance
+}
+
+//ParseRoute parses a route given either as a GeoJSON LineString or as a JSON array of {"lat": .., "lon": ..} objects
+func ParseRoute(b []byte) ([]Position, error) {
+	var positions []struct {
+		Lat *float64 `json:"lat"`
+		Lon *float64 `json:"lon"`
+	}
+	if err := json.Unmarshal(b, &positions); err != nil {
+		route, err := ParseGeoJSONLineString(b)
+		if err != nil {
+			return nil, err
+		}
+		return route, validateRoute(route)
+	}
+	route := make([]Position, 0, len(positions))
+	for _, position := range positions {
+		if position.Lat == nil || position.Lon == nil {
+			return nil, quadrilleError.ErrInvalidRoute
+		}
+		route = append(route, *NewPosition(*position.Lat, *position.Lon))
+	}
+	return route, validateRoute(route)
+}
+
+func validateRoute(route []Position) error {
+	if len(route) < 2 {
+		return quadrilleError.ErrInvalidRoute
+	}
+	for _, position := range route {
+		if !isValidPosition(position) {
+			return quadrilleError.ErrInvalidRoute
+		}
+	}
+	return nil
+}
+
+//Returns the distance in metres from the location to the nearest point of the segment a-b, along with the
+//fraction of the segment at which that point lies. The segment is projected onto a plane tangent at the
+//location, which is accurate for segments much shorter than the radius of the earth. Planar coordinates need no projection.
+func distanceToSegment(location, a, b GeoLocation, model DistanceModel) (distance, fraction float64) {
+	scale := math.Cos(location.Lat() * math.Pi / 180)
+	if model == Planar {
+		scale = 1
+	}
+	ax, ay := a.Long()*scale, a.Lat()
+	bx, by := b.Long()*scale, b.Lat()
+	px, py := location.Long()*scale, location.Lat()
+	dx, dy := bx-ax, by-ay
+	if lengthSquared := dx*dx + dy*dy; lengthSquared > 0 {
+		fraction = math.Max(0, math.Min(1, ((px-ax)*dx+(py-ay)*dy)/lengthSquared))
+	}
+	nearest := NewPosition(a.Lat()+fraction*(b.Lat()-a.Lat()), a.Long()+fraction*(b.Long()-a.Long()))
+	return model.Distance(location, nearest), fraction
+}
+
+//Returns the shortest distance in metres between the segment a-b and the rectangle, 0 if they intersect.
+//For disjoint shapes the nearest points are an end of the segment or a corner of the rectangle.
+func segmentDistanceToRectangle(a, b GeoLocation, r Rectangle, model DistanceModel) float64 {
+	if isWithinBox(r, a) || isWithinBox(r, b) {
+		return 0
+	}
+	corners := r.GetAllCorners()
+	//The first two corners are diagonally opposite, as are the last two
+	edges := [4][2]GeoLocation{{corners[0], corners[2]}, {corners[2], corners[1]}, {corners[1], corners[3]}, {corners[3], corners[0]}}
+	for _, edge := range edges {
+		if segmentsIntersect(a, b, edge[0], edge[1]) {
+			return 0
+		}
+	}
+	nearest := math.Min(model.MinDistanceToRectangle(a, r), model.MinDistanceToRectangle(b, r))
+	for _, corner := range corners {
+		distance, _ := distanceToSegment(corner, a, b, model)
+		nearest = math.Min(nearest, distance)
+	}
+	return nearest
+}
+
+//GetLocationsAlongRoute returns the locations within bufferInMetres of the route, a polyline of at least two positions.
+//Nodes farther than the buffer from every segment of the route are pruned. Results are ordered by the distance
+//along the route of their nearest point on it, the distance to which is their Distance.
+func (q *QuadTree) GetLocationsAlongRoute(route []Position, bufferInMetres, limit int) []CorridorResult {
+	if len(route) < 2 {
+		return []CorridorResult{}
+	}
+	//Distance from the start of the route to the start of each segment
+	offsets := make([]float64, len(route))
+	for i := 1; i < len(route); i++ {
+		offsets[i] = offsets[i-1] + q.distance.Distance(route[i-1], route[i])
+	}
+	buffer := float64(bufferInMetres)
+	alongRoute := map[string]float64{}
+	matchedLeaves := q.findMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			for i := 1; i < len(route); i++ {
+				if segmentDistanceToRectangle(route[i-1], route[i], nodeBox, q.distance) <= buffer {
+					return true
+				}
+			}
+			return false
+		},
+		func(leaf *QuadTreeLeaf) (float64, bool) {
+			nearest, nearestAlongRoute := math.Inf(1), 0.0
+			for i := 1; i < len(route); i++ {
+				distance, fraction := distanceToSegment(leaf.GetLocation(), route[i-1], route[i], q.distance)
+				if distance < nearest {
+					nearest = distance
+					nearestAlongRoute = offsets[i-1] + fraction*(offsets[i]-offsets[i-1])
+				}
+			}
+			if nearest > buffer {
+				return 0, false
+			}
+			alongRoute[leaf.GetLocationID()] = nearestAlongRoute
+			return nearest, true
+		})
+
+	results := make([]CorridorResult, 0, len(matchedLeaves))
+	for _, leaf := range matchedLeaves {
+		results = append(results, CorridorResult{QuadTreeNeighborResult: leaf, DistanceAlongRoute: alongRoute[leaf.Leaf.GetLocationID()]})
+	}
+	sort.Sort(byDistanceAlongRoute(results))
+	if len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,89 @@
+package ds
+
+import (
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"math"
+	"strings"
+)
+
+//DistanceModel measures the distance in metres between locations. Along with the distance a model bounds the
+//distance to a rectangle from below, which the tree relies on to prune nodes without missing any location.
+type DistanceModel interface {
+	Distance(location1, location2 GeoLocation) float64
+	//Returns at most the distance from the location to the nearest point of the rectangle, 0 if it lies inside
+	MinDistanceToRectangle(location GeoLocation, r Rectangle) float64
+	//Returns at most the distance from a location within the rectangle to the nearest point of its boundary
+	MinDistanceToBoxEdge(location GeoLocation, r Rectangle) float64
+}
+
+var (
+	//Haversine measures great circle distances on a sphere of radius 6371km. This is the default model.
+	Haversine DistanceModel = haversineModel{}
+	//Vincenty measures geodesic distances on the WGS84 ellipsoid
+	Vincenty DistanceModel = vincentyModel{}
+	//Planar treats latitudes and longitudes as y and x coordinates in metres on a plane, as in an indoor map
+	Planar DistanceModel = planarModel{}
+)
+
+//ParseDistanceModel returns the model named haversine, vincenty or planar
+func ParseDistanceModel(name string) (DistanceModel, error) {
+	switch strings.ToLower(name) {
+	case "haversine":
+		return Haversine, nil
+	case "vincenty":
+		return Vincenty, nil
+	case "planar":
+		return Planar, nil
+	}
+	return nil, quadrilleError.ErrInvalidDistanceModel
+}
+
+type haversineModel struct{}
+
+func (haversineModel) Distance(location1, location2 GeoLocation) float64 {
+	return DistanceOnEarth(location1, location2)
+}
+
+func (haversineModel) MinDistanceToRectangle(location GeoLocation, r Rectangle) float64 {
+	return minDistanceToRectangle(location, r)
+}
+
+func (haversineModel) MinDistanceToBoxEdge(location GeoLocation, r Rectangle) float64 {
+	return minDistanceToBoxEdge(location, r)
+}
+
+//The radius of curvature of the WGS84 ellipsoid is at least 6335km, along the meridian at the equator, so an
+//ellipsoidal distance is at least 0.994 times the spherical one. The spherical bounds are scaled down with a margin.
+const vincentyToHaversineMinRatio = 0.99
+
+type vincentyModel struct{}
+
+func (vincentyModel) Distance(location1, location2 GeoLocation) float64 {
+	return VincentyDistance(location1, location2)
+}
+
+func (vincentyModel) MinDistanceToRectangle(location GeoLocation, r Rectangle) float64 {
+	return minDistanceToRectangle(location, r) * vincentyToHaversineMinRatio
+}
+
+func (vincentyModel) MinDistanceToBoxEdge(location GeoLocation, r Rectangle) float64 {
+	return minDistanceToBoxEdge(location, r) * vincentyToHaversineMinRatio
+}
+
+type planarModel struct{}
+
+func (planarModel) Distance(location1, location2 GeoLocation) float64 {
+	return EuclideanDistance(location1, location2)
+}
+
+func (planarModel) MinDistanceToRectangle(location GeoLocation, r Rectangle) float64 {
+	minLat, minLong, maxLat, maxLong := getBoxBounds(r)
+	dx := math.Max(0, math.Max(minLong-location.Long(), location.Long()-maxLong))
+	dy := math.Max(0, math.Max(minLat-location.Lat(), location.Lat()-maxLat))
+	return math.Hypot(dx, dy)
+}
+
+func (planarModel) MinDistanceToBoxEdge(location GeoLocation, r Rectangle) float64 {
+	minLat, minLong, maxLat, maxLong := getBoxBounds(r)
+	return math.Min(math.Min(location.Long()-minLong, maxLong-location.Long()), math.Min(location.Lat()-minLat, maxLat-location.Lat()))
+}
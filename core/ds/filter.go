@@ -0,0 +1,245 @@
+package ds
+
+import (
+	"encoding/json"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"reflect"
+	"strings"
+)
+
+//Filter is a predicate on the Data of a location. A nil Filter matches every location.
+type Filter func(data map[string]interface{}) bool
+
+const (
+	filterAnd    = "$and"
+	filterOr     = "$or"
+	filterEq     = "$eq"
+	filterNe     = "$ne"
+	filterGt     = "$gt"
+	filterGte    = "$gte"
+	filterLt     = "$lt"
+	filterLte    = "$lte"
+	filterIn     = "$in"
+	filterExists = "$exists"
+)
+
+//Matches returns true if the data satisfies the filter
+func (f Filter) Matches(data map[string]interface{}) bool {
+	return f == nil || f(data)
+}
+
+//ParseFilter parses a JSON filter expression such as
+//  {"status": "available", "vehicle.type": {"$in": ["sedan", "suv"]}, "$or": [{"rating": {"$gte": 4}}, {"new": true}]}
+//Keys are dot separated paths into the data. A plain value is matched for equality, while an object of operators
+//($eq, $ne, $gt, $gte, $lt, $lte, $in, $exists) must satisfy all of them. $and and $or take an array of expressions.
+//All the conditions of an expression must be satisfied.
+func ParseFilter(expression string) (Filter, error) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal([]byte(expression), &spec); err != nil {
+		return nil, quadrilleError.ErrInvalidFilter
+	}
+	return newFilter(spec)
+}
+
+func newFilter(spec map[string]interface{}) (Filter, error) {
+	conditions := make([]Filter, 0, len(spec))
+	for key, val := range spec {
+		var condition Filter
+		var err error
+		switch key {
+		case filterAnd, filterOr:
+			condition, err = newLogicalFilter(key, val)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, quadrilleError.ErrUnsupportedFilterOperator
+			}
+			condition, err = newFieldFilter(key, val)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return allOf(conditions), nil
+}
+
+func allOf(conditions []Filter) Filter {
+	return func(data map[string]interface{}) bool {
+		for _, condition := range conditions {
+			if !condition(data) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func anyOf(conditions []Filter) Filter {
+	return func(data map[string]interface{}) bool {
+		for _, condition := range conditions {
+			if condition(data) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func newLogicalFilter(operator string, val interface{}) (Filter, error) {
+	specs, ok := val.([]interface{})
+	if !ok || len(specs) == 0 {
+		return nil, quadrilleError.ErrInvalidFilter
+	}
+	conditions := make([]Filter, 0, len(specs))
+	for _, spec := range specs {
+		specMap, ok := spec.(map[string]interface{})
+		if !ok {
+			return nil, quadrilleError.ErrInvalidFilter
+		}
+		condition, err := newFilter(specMap)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	if operator == filterOr {
+		return anyOf(conditions), nil
+	}
+	return allOf(conditions), nil
+}
+
+func newFieldFilter(path string, val interface{}) (Filter, error) {
+	operators, ok := val.(map[string]interface{})
+	if !ok || !isOperatorMap(operators) {
+		return newOperatorFilter(path, filterEq, val)
+	}
+	conditions := make([]Filter, 0, len(operators))
+	for operator, operand := range operators {
+		condition, err := newOperatorFilter(path, operator, operand)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	return allOf(conditions), nil
+}
+
+func isOperatorMap(m map[string]interface{}) bool {
+	if len(m) == 0 {
+		return false
+	}
+	for key := range m {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func newOperatorFilter(path, operator string, operand interface{}) (Filter, error) {
+	keys := strings.Split(path, ".")
+	var matches func(val interface{}, exists bool) bool
+	switch operator {
+	case filterEq:
+		matches = func(val interface{}, exists bool) bool {
+			return exists && isEqual(val, operand)
+		}
+	case filterNe:
+		matches = func(val interface{}, exists bool) bool {
+			return !exists || !isEqual(val, operand)
+		}
+	case filterGt, filterGte, filterLt, filterLte:
+		if _, ok := compare(operand, operand); !ok {
+			return nil, quadrilleError.ErrInvalidFilter
+		}
+		matches = func(val interface{}, exists bool) bool {
+			cmp, ok := compare(val, operand)
+			if !exists || !ok {
+				return false
+			}
+			switch operator {
+			case filterGt:
+				return cmp > 0
+			case filterGte:
+				return cmp >= 0
+			case filterLt:
+				return cmp < 0
+			default:
+				return cmp <= 0
+			}
+		}
+	case filterIn:
+		candidates, ok := operand.([]interface{})
+		if !ok {
+			return nil, quadrilleError.ErrInvalidFilter
+		}
+		matches = func(val interface{}, exists bool) bool {
+			for _, candidate := range candidates {
+				if exists && isEqual(val, candidate) {
+					return true
+				}
+			}
+			return false
+		}
+	case filterExists:
+		shouldExist, ok := operand.(bool)
+		if !ok {
+			return nil, quadrilleError.ErrInvalidFilter
+		}
+		matches = func(val interface{}, exists bool) bool {
+			return exists == shouldExist
+		}
+	default:
+		return nil, quadrilleError.ErrUnsupportedFilterOperator
+	}
+	return func(data map[string]interface{}) bool {
+		val, exists := getDataValue(data, keys)
+		return matches(val, exists)
+	}, nil
+}
+
+//Returns the value at the nested path of keys within data
+func getDataValue(data map[string]interface{}, keys []string) (interface{}, bool) {
+	var cur interface{} = data
+	for _, key := range keys {
+		curMap, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = curMap[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func isEqual(val1, val2 interface{}) bool {
+	if cmp, ok := compare(val1, val2); ok {
+		return cmp == 0
+	}
+	return reflect.DeepEqual(val1, val2)
+}
+
+//Compares two numbers or two strings. ok is false if the values are not comparable.
+func compare(val1, val2 interface{}) (cmp int, ok bool) {
+	switch v1 := val1.(type) {
+	case float64:
+		v2, ok := val2.(float64)
+		if !ok {
+			return 0, false
+		}
+		if v1 < v2 {
+			return -1, true
+		} else if v1 > v2 {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		v2, ok := val2.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(v1, v2), true
+	}
+	return 0, false
+}
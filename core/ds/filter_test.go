@@ -0,0 +1,49 @@
+package ds
+
+import (
+	"encoding/json"
+	"github.com/quadrille/quadrille/core/errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	var data map[string]interface{}
+	json.Unmarshal([]byte(`{"status":"available","rating":4.5,"vehicle":{"type":"suv","seats":6}}`), &data)
+
+	testCases := []struct {
+		expression string
+		expected   bool
+	}{
+		{`{}`, true},
+		{`{"status":"available"}`, true},
+		{`{"status":"busy"}`, false},
+		{`{"vehicle.type":"suv","vehicle.seats":6}`, true},
+		{`{"vehicle.seats":{"$gte":4,"$lt":6}}`, false},
+		{`{"rating":{"$gt":4}}`, true},
+		{`{"status":{"$ne":"busy"}}`, true},
+		{`{"vehicle.type":{"$in":["sedan","suv"]}}`, true},
+		{`{"vehicle.color":{"$exists":false}}`, true},
+		{`{"vehicle.type":{"$exists":true}}`, true},
+		{`{"$or":[{"status":"busy"},{"rating":{"$lte":4.5}}]}`, true},
+		{`{"$and":[{"status":"available"},{"vehicle.type":"sedan"}]}`, false},
+	}
+	for _, testCase := range testCases {
+		filter, err := ParseFilter(testCase.expression)
+		if err != nil {
+			t.Fatalf("ParseFilter(%s): expected no error, got %s", testCase.expression, err.Error())
+		}
+		if filter.Matches(data) != testCase.expected {
+			t.Fatalf("ParseFilter(%s): expected %v, got %v", testCase.expression, testCase.expected, !testCase.expected)
+		}
+	}
+
+	_, err := ParseFilter(`{"status":{"$regex":"av"}}`)
+	if !reflect.DeepEqual(err, errors.ErrUnsupportedFilterOperator) {
+		t.Fatalf("Expected ErrUnsupportedFilterOperator, got %v", err)
+	}
+	_, err = ParseFilter(`{"$or":{"status":"busy"}}`)
+	if !reflect.DeepEqual(err, errors.ErrInvalidFilter) {
+		t.Fatalf("Expected ErrInvalidFilter, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package ds
+
+import quadrilleError "github.com/quadrille/quadrille/core/errors"
+
+//Geofence is a named zone which is either a circle of Radius metres around Center or a set of Polygons.
+//An entity which stays inside the zone for DwellTime seconds is considered to be dwelling in it.
+type Geofence struct {
+	ID        string                 `json:"id"`
+	Center    *Position              `json:"center,omitempty"`
+	Radius    int                    `json:"radius,omitempty"`
+	Polygons  []Polygon              `json:"polygons,omitempty"`
+	DwellTime int                    `json:"dwellTime,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+func NewCircularGeofence(id string, center Position, radiusInMetres int) *Geofence {
+	return &Geofence{ID: id, Center: &center, Radius: radiusInMetres}
+}
+
+func NewPolygonGeofence(id string, polygons []Polygon) *Geofence {
+	return &Geofence{ID: id, Polygons: polygons}
+}
+
+func (g Geofence) IsCircular() bool {
+	return g.Center != nil
+}
+
+//Contains returns true if the location lies within the geofence, measuring the radius of a circle with the model
+func (g Geofence) Contains(location GeoLocation, model DistanceModel) bool {
+	if g.IsCircular() {
+		return model.Distance(g.Center, location) <= float64(g.Radius)
+	}
+	for _, polygon := range g.Polygons {
+		if polygon.Contains(location) {
+			return true
+		}
+	}
+	return false
+}
+
+//Positions returns the center of a circular geofence, or the positions of the rings of its polygons
+func (g Geofence) Positions() []Position {
+	if g.IsCircular() {
+		return []Position{*g.Center}
+	}
+	positions := []Position{}
+	for _, polygon := range g.Polygons {
+		for _, ring := range polygon.rings() {
+			positions = append(positions, ring...)
+		}
+	}
+	return positions
+}
+
+//Validate ensures the geofence has an ID and exactly one valid shape
+func (g Geofence) Validate() error {
+	if g.ID == "" {
+		return quadrilleError.ErrMissingGeofenceID
+	}
+	if g.DwellTime < 0 {
+		return quadrilleError.ErrInvalidGeofence
+	}
+	if g.IsCircular() {
+		if len(g.Polygons) > 0 || g.Radius <= 0 || !isValidPosition(g.Center) {
+			return quadrilleError.ErrInvalidGeofence
+		}
+		return nil
+	}
+	if len(g.Polygons) == 0 {
+		return quadrilleError.ErrInvalidGeofence
+	}
+	for _, polygon := range g.Polygons {
+		if !polygon.isValid() {
+			return quadrilleError.ErrInvalidPolygon
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package ds
+
+import (
+	"encoding/json"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+)
+
+const (
+	GeoJSONPolygon      = "Polygon"
+	GeoJSONMultiPolygon = "MultiPolygon"
+	GeoJSONLineString   = "LineString"
+)
+
+type geoJSONGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+//ParseGeoJSONPolygons parses a GeoJSON Polygon or MultiPolygon geometry.
+//GeoJSON positions are in [longitude, latitude] order.
+func ParseGeoJSONPolygons(b []byte) ([]Polygon, error) {
+	var geometry geoJSONGeometry
+	if err := json.Unmarshal(b, &geometry); err != nil {
+		return nil, quadrilleError.ErrInvalidGeoJSON
+	}
+	var multiPolygonCoords [][][][]float64
+	switch geometry.Type {
+	case GeoJSONPolygon:
+		var polygonCoords [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &polygonCoords); err != nil {
+			return nil, quadrilleError.ErrInvalidGeoJSON
+		}
+		multiPolygonCoords = [][][][]float64{polygonCoords}
+	case GeoJSONMultiPolygon:
+		if err := json.Unmarshal(geometry.Coordinates, &multiPolygonCoords); err != nil {
+			return nil, quadrilleError.ErrInvalidGeoJSON
+		}
+	default:
+		return nil, quadrilleError.ErrUnsupportedGeoJSONType
+	}
+
+	polygons := make([]Polygon, 0, len(multiPolygonCoords))
+	for _, polygonCoords := range multiPolygonCoords {
+		polygon, err := polygonFromGeoJSONCoords(polygonCoords)
+		if err != nil {
+			return nil, err
+		}
+		polygons = append(polygons, polygon)
+	}
+	if len(polygons) == 0 {
+		return nil, quadrilleError.ErrInvalidPolygon
+	}
+	return polygons, nil
+}
+
+//ParseGeoJSONLineString parses a GeoJSON LineString geometry into its positions
+func ParseGeoJSONLineString(b []byte) ([]Position, error) {
+	var geometry geoJSONGeometry
+	if err := json.Unmarshal(b, &geometry); err != nil {
+		return nil, quadrilleError.ErrInvalidGeoJSON
+	}
+	if geometry.Type != GeoJSONLineString {
+		return nil, quadrilleError.ErrUnsupportedGeoJSONType
+	}
+	var lineCoords [][]float64
+	if err := json.Unmarshal(geometry.Coordinates, &lineCoords); err != nil {
+		return nil, quadrilleError.ErrInvalidGeoJSON
+	}
+	return positionsFromGeoJSONCoords(lineCoords)
+}
+
+func polygonFromGeoJSONCoords(polygonCoords [][][]float64) (Polygon, error) {
+	if len(polygonCoords) == 0 {
+		return Polygon{}, quadrilleError.ErrInvalidPolygon
+	}
+	rings := make([][]Position, 0, len(polygonCoords))
+	for _, ringCoords := range polygonCoords {
+		ring, err := positionsFromGeoJSONCoords(ringCoords)
+		if err != nil {
+			return Polygon{}, err
+		}
+		rings = append(rings, ring)
+	}
+	polygon := *NewPolygon(rings[0], rings[1:]...)
+	if !polygon.isValid() {
+		return Polygon{}, quadrilleError.ErrInvalidPolygon
+	}
+	return polygon, nil
+}
+
+func positionsFromGeoJSONCoords(coords [][]float64) ([]Position, error) {
+	positions := make([]Position, 0, len(coords))
+	for _, coord := range coords {
+		if len(coord) < 2 {
+			return nil, quadrilleError.ErrInvalidGeoJSON
+		}
+		positions = append(positions, *NewPosition(coord[1], coord[0]))
+	}
+	return positions, nil
+}
+
+//PolygonsToGeoJSON encodes the polygons as a GeoJSON MultiPolygon geometry
+func PolygonsToGeoJSON(polygons []Polygon) ([]byte, error) {
+	multiPolygonCoords := make([][][][]float64, 0, len(polygons))
+	for _, polygon := range polygons {
+		polygonCoords := make([][][]float64, 0, len(polygon.Holes)+1)
+		for _, ring := range polygon.rings() {
+			polygonCoords = append(polygonCoords, positionsToGeoJSONCoords(ring, true))
+		}
+		multiPolygonCoords = append(multiPolygonCoords, polygonCoords)
+	}
+	coordinates, err := json.Marshal(multiPolygonCoords)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geoJSONGeometry{Type: GeoJSONMultiPolygon, Coordinates: coordinates})
+}
+
+//LineStringToGeoJSON encodes the positions as a GeoJSON LineString geometry
+func LineStringToGeoJSON(line []Position) ([]byte, error) {
+	coordinates, err := json.Marshal(positionsToGeoJSONCoords(line, false))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(geoJSONGeometry{Type: GeoJSONLineString, Coordinates: coordinates})
+}
+
+//GeoJSON expects linear rings to end with their first position, so closeRing appends it when missing
+func positionsToGeoJSONCoords(positions []Position, closeRing bool) [][]float64 {
+	coords := make([][]float64, 0, len(positions)+1)
+	for _, position := range positions {
+		coords = append(coords, []float64{position.Long(), position.Lat()})
+	}
+	if closeRing && len(positions) > 0 && positions[0] != positions[len(positions)-1] {
+		coords = append(coords, []float64{positions[0].Long(), positions[0].Lat()})
+	}
+	return coords
+}
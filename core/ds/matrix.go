@@ -0,0 +1,83 @@
+package ds
+
+import (
+	"encoding/json"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+)
+
+//Largest number of origin-destination pairs measured by a single distance matrix
+const MaxMatrixPairs = 10000
+
+//MatrixPoint is an origin or destination of a distance matrix, either a stored location referenced by its ID or a position
+type MatrixPoint struct {
+	LocationID string
+	Position   *Position
+}
+
+//UnmarshalJSON accepts either a location ID string or a {"lat": .., "lon": ..} object
+func (p *MatrixPoint) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &p.LocationID); err == nil {
+		if p.LocationID == "" {
+			return quadrilleError.ErrInvalidMatrix
+		}
+		return nil
+	}
+	var position struct {
+		Lat *float64 `json:"lat"`
+		Lon *float64 `json:"lon"`
+	}
+	if err := json.Unmarshal(b, &position); err != nil || position.Lat == nil || position.Lon == nil {
+		return quadrilleError.ErrInvalidMatrix
+	}
+	p.Position = NewPosition(*position.Lat, *position.Lon)
+	return nil
+}
+
+//MarshalJSON writes the point in the form accepted by UnmarshalJSON
+func (p MatrixPoint) MarshalJSON() ([]byte, error) {
+	if p.Position == nil {
+		return json.Marshal(p.LocationID)
+	}
+	return json.Marshal(map[string]float64{"lat": p.Position.Lat(), "lon": p.Position.Long()})
+}
+
+//DistanceMatrix returns the distance from each origin to each destination as measured by the distance model of the tree,
+//with a row per origin. Stored locations are measured from their current positions.
+func (q *QuadTree) DistanceMatrix(origins, destinations []MatrixPoint) ([][]float64, error) {
+	if len(origins) == 0 || len(destinations) == 0 || len(origins)*len(destinations) > MaxMatrixPairs {
+		return nil, quadrilleError.ErrInvalidMatrix
+	}
+	originPositions, err := q.resolveMatrixPoints(origins)
+	if err != nil {
+		return nil, err
+	}
+	destinationPositions, err := q.resolveMatrixPoints(destinations)
+	if err != nil {
+		return nil, err
+	}
+	matrix := make([][]float64, len(originPositions))
+	for i, origin := range originPositions {
+		matrix[i] = make([]float64, len(destinationPositions))
+		for j, destination := range destinationPositions {
+			matrix[i][j] = q.distance.Distance(origin, destination)
+		}
+	}
+	return matrix, nil
+}
+
+//Returns the positions of the points, looking up those referencing a stored location
+func (q *QuadTree) resolveMatrixPoints(points []MatrixPoint) ([]Position, error) {
+	positions := make([]Position, 0, len(points))
+	for _, point := range points {
+		if point.Position != nil {
+			positions = append(positions, *point.Position)
+			continue
+		}
+		leaf, err := q.Get(point.LocationID)
+		if err != nil {
+			return nil, err
+		}
+		positions = append(positions, leaf.Location)
+	}
+	return positions, nil
+}
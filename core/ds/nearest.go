@@ -0,0 +1,74 @@
+package ds
+
+import "container/heap"
+
+//nearestCandidate is either an unexplored node or a leaf, keyed by its (minimum) distance from the query location
+type nearestCandidate struct {
+	node     *QuadTreeNode
+	leaf     *QuadTreeLeaf
+	distance float64
+}
+
+type nearestCandidateQueue []nearestCandidate
+
+func (pq nearestCandidateQueue) Len() int {
+	return len(pq)
+}
+
+func (pq nearestCandidateQueue) Less(i, j int) bool {
+	return pq[i].distance < pq[j].distance
+}
+
+func (pq nearestCandidateQueue) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+}
+
+func (pq *nearestCandidateQueue) Push(x interface{}) {
+	*pq = append(*pq, x.(nearestCandidate))
+}
+
+func (pq *nearestCandidateQueue) Pop() interface{} {
+	old := *pq
+	n := len(old)
+	candidate := old[n-1]
+	*pq = old[:n-1]
+	return candidate
+}
+
+//GetNearestLocations returns the k locations closest to the given location, nearest first.
+//The tree is searched best-first, ordering nodes by the minimum distance to their bounding box,
+//so only the nodes that can contain one of the k nearest locations are visited.
+//If maxDistanceInMetres is greater than 0, locations farther than it are not returned.
+func (q *QuadTree) GetNearestLocations(location Position, k, maxDistanceInMetres int) []QuadTreeNeighborResult {
+	results := []QuadTreeNeighborResult{}
+	if k <= 0 {
+		return results
+	}
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	pq := &nearestCandidateQueue{{node: q.root, distance: 0}}
+	for pq.Len() > 0 && len(results) < k {
+		candidate := heap.Pop(pq).(nearestCandidate)
+		if maxDistanceInMetres > 0 && candidate.distance > float64(maxDistanceInMetres) {
+			break
+		}
+		if candidate.leaf != nil {
+			results = append(results, *NewQuadTreeNeighborResult(*candidate.leaf, candidate.distance))
+			continue
+		}
+		node := candidate.node
+		if node.leaves != nil {
+			node.leavesMtx.RLock()
+			for _, leaf := range *node.leaves {
+				leafCopy := *leaf
+				heap.Push(pq, nearestCandidate{leaf: &leafCopy, distance: q.distance.Distance(location, leaf.GetLocation())})
+			}
+			node.leavesMtx.RUnlock()
+		} else if node.children != nil {
+			for _, child := range node.children {
+				heap.Push(pq, nearestCandidate{node: child, distance: q.distance.MinDistanceToRectangle(location, child.boundingBox)})
+			}
+		}
+	}
+	return results
+}
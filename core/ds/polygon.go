@@ -0,0 +1,166 @@
+package ds
+
+import "math"
+
+//Polygon is a closed shape made of an exterior ring and optional holes.
+//Rings are treated as closed, so repeating the first position at the end is optional.
+type Polygon struct {
+	Exterior []Position
+	Holes    [][]Position
+}
+
+func NewPolygon(exterior []Position, holes ...[]Position) *Polygon {
+	return &Polygon{Exterior: exterior, Holes: holes}
+}
+
+func (p Polygon) rings() [][]Position {
+	return append([][]Position{p.Exterior}, p.Holes...)
+}
+
+//Contains returns true if the location lies inside the exterior ring and outside all the holes
+func (p Polygon) Contains(location GeoLocation) bool {
+	if !ringContains(p.Exterior, location) {
+		return false
+	}
+	for _, hole := range p.Holes {
+		if ringContains(hole, location) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p Polygon) BoundingBox() Rectangle {
+	minLat, minLong, maxLat, maxLong := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, position := range p.Exterior {
+		minLat, maxLat = math.Min(minLat, position.Lat()), math.Max(maxLat, position.Lat())
+		minLong, maxLong = math.Min(minLong, position.Long()), math.Max(maxLong, position.Long())
+	}
+	return NewRectangle(NewPosition(minLat, minLong), NewPosition(maxLat, maxLong))
+}
+
+//IntersectsRectangle returns true if any part of the polygon overlaps the rectangle
+func (p Polygon) IntersectsRectangle(r Rectangle) bool {
+	if !boxesIntersect(p.BoundingBox(), r) {
+		return false
+	}
+	corners := r.GetAllCorners()
+	for _, corner := range corners {
+		if p.Contains(corner) {
+			return true
+		}
+	}
+	//corners are ordered diagonally, so the edges are formed by pairing each of the first two with the last two
+	edges := [4][2]GeoLocation{
+		{corners[0], corners[2]}, {corners[0], corners[3]},
+		{corners[1], corners[2]}, {corners[1], corners[3]},
+	}
+	for _, ring := range p.rings() {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			if isWithinBox(r, ring[i]) {
+				return true
+			}
+			for _, edge := range edges {
+				if segmentsIntersect(ring[j], ring[i], edge[0], edge[1]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (p Polygon) isValid() bool {
+	for _, ring := range p.rings() {
+		if len(ring) < 3 {
+			return false
+		}
+		for _, position := range ring {
+			if !isValidPosition(position) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//Positions are only required to be finite here, as the range they must lie in depends on the bounds of the tree
+func isValidPosition(position GeoLocation) bool {
+	return isFinite(position.Lat()) && isFinite(position.Long())
+}
+
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+//Uses ray casting with longitude as x and latitude as y
+func ringContains(ring []Position, location GeoLocation) bool {
+	contains := false
+	x, y := location.Long(), location.Lat()
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi, xj, yj := ring[i].Long(), ring[i].Lat(), ring[j].Long(), ring[j].Lat()
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			contains = !contains
+		}
+	}
+	return contains
+}
+
+//Returns the orientation of the ordered triplet: 0 if collinear, 1 if clockwise and -1 if counterclockwise
+func orientation(p, q, r GeoLocation) int {
+	val := (q.Lat()-p.Lat())*(r.Long()-q.Long()) - (q.Long()-p.Long())*(r.Lat()-q.Lat())
+	if val > 0 {
+		return 1
+	} else if val < 0 {
+		return -1
+	}
+	return 0
+}
+
+//Returns true if r lies on the segment pq, given that the three are collinear
+func onSegment(p, q, r GeoLocation) bool {
+	return r.Long() <= math.Max(p.Long(), q.Long()) && r.Long() >= math.Min(p.Long(), q.Long()) &&
+		r.Lat() <= math.Max(p.Lat(), q.Lat()) && r.Lat() >= math.Min(p.Lat(), q.Lat())
+}
+
+func segmentsIntersect(p1, q1, p2, q2 GeoLocation) bool {
+	o1, o2, o3, o4 := orientation(p1, q1, p2), orientation(p1, q1, q2), orientation(p2, q2, p1), orientation(p2, q2, q1)
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+	return (o1 == 0 && onSegment(p1, q1, p2)) || (o2 == 0 && onSegment(p1, q1, q2)) ||
+		(o3 == 0 && onSegment(p2, q2, p1)) || (o4 == 0 && onSegment(p2, q2, q1))
+}
+
+//Reports whether any of the polygons, whose combined bounding box is bounds, intersects the box
+func polygonsIntersectBox(polygons []Polygon, bounds, box Rectangle) bool {
+	if !boxesIntersect(box, bounds) {
+		return false
+	}
+	for _, polygon := range polygons {
+		if polygon.IntersectsRectangle(box) {
+			return true
+		}
+	}
+	return false
+}
+
+//Reports whether any of the polygons contains the location
+func polygonsContain(polygons []Polygon, location GeoLocation) bool {
+	for _, polygon := range polygons {
+		if polygon.Contains(location) {
+			return true
+		}
+	}
+	return false
+}
+
+func getPolygonsBoundingBox(polygons []Polygon) Rectangle {
+	minLat, minLong, maxLat, maxLong := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, polygon := range polygons {
+		pMinLat, pMinLong, pMaxLat, pMaxLong := getBoxBounds(polygon.BoundingBox())
+		minLat, maxLat = math.Min(minLat, pMinLat), math.Max(maxLat, pMaxLat)
+		minLong, maxLong = math.Min(minLong, pMinLong), math.Max(maxLong, pMaxLong)
+	}
+	return NewRectangle(NewPosition(minLat, minLong), NewPosition(maxLat, maxLong))
+}
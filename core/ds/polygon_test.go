@@ -0,0 +1,69 @@
+package ds
+
+import (
+	"github.com/quadrille/quadrille/core/errors"
+	"reflect"
+	"testing"
+)
+
+func TestPolygon(t *testing.T) {
+	exterior := []Position{*NewPosition(0, 0), *NewPosition(0, 10), *NewPosition(10, 10), *NewPosition(10, 0)}
+	hole := []Position{*NewPosition(4, 4), *NewPosition(4, 6), *NewPosition(6, 6), *NewPosition(6, 4)}
+	polygon := NewPolygon(exterior, hole)
+
+	if !polygon.Contains(NewPosition(2, 2)) {
+		t.Fatalf("Contains: expected %v to be inside polygon", NewPosition(2, 2))
+	}
+	if polygon.Contains(NewPosition(5, 5)) {
+		t.Fatalf("Contains: expected %v to be inside hole", NewPosition(5, 5))
+	}
+	if polygon.Contains(NewPosition(11, 5)) {
+		t.Fatalf("Contains: expected %v to be outside polygon", NewPosition(11, 5))
+	}
+
+	crossingEdge := NewRectangle(NewPosition(-1, 4), NewPosition(1, 6))
+	if !polygon.IntersectsRectangle(crossingEdge) {
+		t.Fatalf("IntersectsRectangle: expected %v to intersect", crossingEdge)
+	}
+	insideHole := NewRectangle(NewPosition(4.5, 4.5), NewPosition(5.5, 5.5))
+	if polygon.IntersectsRectangle(insideHole) {
+		t.Fatalf("IntersectsRectangle: expected %v not to intersect", insideHole)
+	}
+	enclosing := NewRectangle(NewPosition(-20, -20), NewPosition(20, 20))
+	if !polygon.IntersectsRectangle(enclosing) {
+		t.Fatalf("IntersectsRectangle: expected %v to intersect", enclosing)
+	}
+}
+
+func TestParseGeoJSONPolygons(t *testing.T) {
+	polygons, err := ParseGeoJSONPolygons([]byte(`{"type":"Polygon","coordinates":[[[0,0],[10,0],[10,10],[0,10],[0,0]]]}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err.Error())
+	}
+	if len(polygons) != 1 || !polygons[0].Contains(NewPosition(5, 5)) {
+		t.Fatalf("Unexpected Polygon parse result %v", polygons)
+	}
+
+	polygons, err = ParseGeoJSONPolygons([]byte(`{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1]]],[[[5,5],[6,5],[6,6]]]]}`))
+	if err != nil || len(polygons) != 2 {
+		t.Fatalf("Expected 2 polygons, got %v, %v", polygons, err)
+	}
+
+	encoded, err := PolygonsToGeoJSON(polygons)
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err.Error())
+	}
+	decoded, err := ParseGeoJSONPolygons(encoded)
+	if err != nil || len(decoded) != 2 {
+		t.Fatalf("Expected encoded polygons to round trip, got %v, %v", decoded, err)
+	}
+
+	_, err = ParseGeoJSONPolygons([]byte(`{"type":"Point","coordinates":[0,0]}`))
+	if !reflect.DeepEqual(err, errors.ErrUnsupportedGeoJSONType) {
+		t.Fatalf("Expected ErrUnsupportedGeoJSONType, got %v", err)
+	}
+	_, err = ParseGeoJSONPolygons([]byte(`{"type":"Polygon","coordinates":[[[0,0],[10,0]]]}`))
+	if !reflect.DeepEqual(err, errors.ErrInvalidPolygon) {
+		t.Fatalf("Expected ErrInvalidPolygon, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package ds
+
+import (
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"sort"
+	"strings"
+)
+
+//Projection is a set of paths into the Data of a location, each a list of keys, selecting the parts of the data to return.
+//A nil Projection selects all of the data.
+type Projection [][]string
+
+//ParseProjection parses a comma separated list of dot separated paths such as
+//  name,vehicle.plate,vehicle.specs.seats
+//A path within another one is dropped, as the other selects it already. An empty list yields a nil Projection.
+func ParseProjection(fields string) (Projection, error) {
+	if fields == "" {
+		return nil, nil
+	}
+	paths := Projection{}
+	for _, path := range strings.Split(fields, ",") {
+		keys := strings.Split(path, ".")
+		for _, key := range keys {
+			if key == "" {
+				return nil, quadrilleError.ErrInvalidProjection
+			}
+		}
+		paths = append(paths, keys)
+	}
+	//Ordering the paths key by key places each one right after the paths it lies within, as those are its prefixes
+	sort.Slice(paths, func(i, j int) bool {
+		return comparePaths(paths[i], paths[j]) < 0
+	})
+	projection := Projection{}
+	for _, keys := range paths {
+		if n := len(projection); n > 0 && isPathWithin(keys, projection[n-1]) {
+			continue
+		}
+		projection = append(projection, keys)
+	}
+	return projection, nil
+}
+
+func comparePaths(path1, path2 []string) int {
+	for i := 0; i < len(path1) && i < len(path2); i++ {
+		if cmp := strings.Compare(path1[i], path2[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return len(path1) - len(path2)
+}
+
+//Reports whether the path lies within, or is the same as, the parent path
+func isPathWithin(path, parent []string) bool {
+	if len(path) < len(parent) {
+		return false
+	}
+	for i, key := range parent {
+		if path[i] != key {
+			return false
+		}
+	}
+	return true
+}
+
+//Apply returns the parts of the data selected by the projection, nested as they are within the data.
+//Paths missing from the data are left out. The data itself is left unchanged.
+func (p Projection) Apply(data map[string]interface{}) map[string]interface{} {
+	if p == nil || data == nil {
+		return data
+	}
+	projected := map[string]interface{}{}
+	for _, keys := range p {
+		val, exists := getDataValue(data, keys)
+		if !exists {
+			continue
+		}
+		//As no path lies within another, each map along the way is one created for the projection
+		cur := projected
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := cur[key].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				cur[key] = next
+			}
+			cur = next
+		}
+		cur[keys[len(keys)-1]] = val
+	}
+	return projected
+}
+
+//String returns the projection in the form accepted by ParseProjection
+func (p Projection) String() string {
+	paths := make([]string, 0, len(p))
+	for _, keys := range p {
+		paths = append(paths, strings.Join(keys, "."))
+	}
+	return strings.Join(paths, ",")
+}
@@ -0,0 +1,46 @@
+package ds
+
+import (
+	"encoding/json"
+	"github.com/quadrille/quadrille/core/errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseProjection(t *testing.T) {
+	var data map[string]interface{}
+	json.Unmarshal([]byte(`{"name":"ravi","rating":4.5,"vehicle":{"plate":"KA01","specs":{"seats":6,"fuel":"ev"}}}`), &data)
+	original, _ := json.Marshal(data)
+
+	testCases := []struct {
+		fields   string
+		expected string
+	}{
+		{``, string(original)},
+		{`name`, `{"name":"ravi"}`},
+		{`name,vehicle.plate`, `{"name":"ravi","vehicle":{"plate":"KA01"}}`},
+		{`vehicle.specs.seats,vehicle.plate,missing,vehicle.specs.missing`, `{"vehicle":{"plate":"KA01","specs":{"seats":6}}}`},
+		{`vehicle.specs.seats,vehicle,vehicle-2`, `{"vehicle":{"plate":"KA01","specs":{"fuel":"ev","seats":6}}}`},
+		{`name.first`, `{}`},
+	}
+	for _, testCase := range testCases {
+		projection, err := ParseProjection(testCase.fields)
+		if err != nil {
+			t.Fatalf("ParseProjection(%s): expected no error, got %s", testCase.fields, err.Error())
+		}
+		var expected map[string]interface{}
+		json.Unmarshal([]byte(testCase.expected), &expected)
+		if projected := projection.Apply(data); !reflect.DeepEqual(projected, expected) {
+			t.Fatalf("ParseProjection(%s): expected %v, got %v", testCase.fields, expected, projected)
+		}
+	}
+	if projected, _ := json.Marshal(data); string(projected) != string(original) {
+		t.Fatalf("Expected the data to be left unchanged, got %s", projected)
+	}
+
+	for _, fields := range []string{`name,`, `vehicle..plate`, `.name`} {
+		if _, err := ParseProjection(fields); err != errors.ErrInvalidProjection {
+			t.Fatalf("ParseProjection(%s): expected %v, got %v", fields, errors.ErrInvalidProjection, err)
+		}
+	}
+}
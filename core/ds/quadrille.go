@@ -1,12 +1,34 @@
 package ds
 
 type Quadrille interface {
-	Insert(string, Position, map[string]interface{})
+	Insert(string, Position, map[string]interface{}, int64)
 	Delete(string) error
-	Update(string, Position, map[string]interface{}) error
-	UpdateLocation(string, Position) error
-	UpdateData(string, map[string]interface{}) error
-	GetNearbyLocations(Position, int, int) []QuadTreeNeighborResult
+	Update(string, Position, map[string]interface{}, int64) error
+	UpdateLocation(string, Position, int64) error
+	UpdateData(string, map[string]interface{}, int64) error
+	GetNearbyLocations(Position, int, int, Filter, int64) []QuadTreeNeighborResult
+	GetNearbyLocationsWithAltitude(Position, int, int, Filter, int64, AltitudeQuery) []QuadTreeNeighborResult
+	GetLocationsInBox(Position, Position, int, int64) []QuadTreeNeighborResult
+	GetLocationsInPolygon([]Polygon, int) []QuadTreeNeighborResult
+	GetLocationsInGeohash(string, int) ([]QuadTreeNeighborResult, error)
+	CountNearbyLocations(Position, int, Filter, int64, AltitudeQuery, int) int
+	CountLocationsInBox(Position, Position, int64, int) int
+	CountLocationsInPolygon([]Polygon, int) int
+	GetLocationsAlongRoute([]Position, int, int) []CorridorResult
+	GetNearestLocations(Position, int, int) []QuadTreeNeighborResult
+	Aggregate(Position, Position, int, string) []GridCell
+	GetClusters(Position, Position, int, int) []Cluster
 	Get(string) (QuadTreeLeaf, error)
 	GetAllLocations() QuadTreeSnapshot
+	Stats() TreeStats
+	DistanceModel() DistanceModel
+	IsPlanar() bool
+	Contains(GeoLocation) bool
+	DistanceMatrix([]MatrixPoint, []MatrixPoint) ([][]float64, error)
+	SetShape(Shape, int64) error
+	DeleteShape(string) error
+	GetShape(string) (Shape, error)
+	GetAllShapes() []Shape
+	GetShapesNearby(Position, int, int) []ShapeResult
+	GetShapesContaining(Position) []Shape
 }
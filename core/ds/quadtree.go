@@ -3,15 +3,16 @@ package ds
 import (
 	quadrilleError "github.com/quadrille/quadrille/core/errors"
 	"sort"
+	"strings"
 	"sync"
 )
 
 type QuadTreeNode struct {
 	boundingBox Rectangle         //Bounds of the current node
-	children    *[4]*QuadTreeNode //Quadrants of the current node.  This is lazily initialized to conserve memory
-	once        sync.Once         //Mutex to ensure single init of children
+	children    *[4]*QuadTreeNode //Quadrants of the current node. This is only set once the node has been split
+	depth       int               //Depth of the node, the root being at depth 0
 	isLeaf      bool
-	leaves      *map[string]*QuadTreeLeaf //Leaves which contain the actual LocationID
+	leaves      *map[string]*QuadTreeLeaf //Leaves which contain the actual LocationID. This is only set while the node is not split
 	leavesMtx   sync.RWMutex              //Mutex to synchronize the leaves
 	parent      *QuadTreeNode
 }
@@ -39,11 +40,14 @@ func NewQuadTreeNeighborResult(leaf QuadTreeLeaf, distance float64) *QuadTreeNei
 }
 
 func NewQuadTreeNode(boundingBox Rectangle, children *[4]*QuadTreeNode, isLeaf bool, leaves *map[string]*QuadTreeLeaf, parent *QuadTreeNode) *QuadTreeNode {
-	return &QuadTreeNode{boundingBox: boundingBox, children: children, isLeaf: isLeaf, leaves: leaves, parent: parent}
+	node := &QuadTreeNode{boundingBox: boundingBox, children: children, isLeaf: isLeaf, leaves: leaves, parent: parent}
+	if parent != nil {
+		node.depth = parent.depth + 1
+	}
+	return node
 }
 
 func (q *QuadTreeNode) findContainingChild(location GeoLocation) *QuadTreeNode {
-	initChildren(q)
 	for _, child := range q.children {
 		box := child.boundingBox
 		if isWithinBox(box, location) {
@@ -53,42 +57,41 @@ func (q *QuadTreeNode) findContainingChild(location GeoLocation) *QuadTreeNode {
 	return nil
 }
 
-//This function is used to lazily initialize children as it is only needed to be set for non-empty nodes
-func initChildren(q *QuadTreeNode) {
-	//The function passed to the below sync.Once is only executed once for the node q
-	q.once.Do(func() {
-		//Code to initialize children of node q
-		var children [4]*QuadTreeNode
-		sections := q.boundingBox.GetQuadrants()
-		for i := 0; i < 4; i++ {
-			children[i] = NewQuadTreeNode(sections[i], nil, false, nil, q)
-		}
-		q.children = &children
-	})
-}
-
-func isWithinBox(box Rectangle, location GeoLocation) bool {
-	minLong, minLat, maxLong, maxLat := box.Corner1().Long(), box.Corner1().Lat(), box.Corner2().Long(), box.Corner2().Lat()
+//Returns the bounds of the box irrespective of the order in which its corners were specified
+func getBoxBounds(box Rectangle) (minLat, minLong, maxLat, maxLong float64) {
+	minLong, minLat, maxLong, maxLat = box.Corner1().Long(), box.Corner1().Lat(), box.Corner2().Long(), box.Corner2().Lat()
 	if minLong > maxLong {
 		minLong, maxLong = maxLong, minLong
 	}
 	if minLat > maxLat {
 		minLat, maxLat = maxLat, minLat
 	}
+	return
+}
+
+func isWithinBox(box Rectangle, location GeoLocation) bool {
+	minLat, minLong, maxLat, maxLong := getBoxBounds(box)
 	if location.Lat() >= minLat && location.Lat() <= maxLat && location.Long() >= minLong && location.Long() <= maxLong {
 		return true
 	}
 	return false
 }
 
+func boxesIntersect(box1, box2 Rectangle) bool {
+	minLat1, minLong1, maxLat1, maxLong1 := getBoxBounds(box1)
+	minLat2, minLong2, maxLat2, maxLong2 := getBoxBounds(box2)
+	return minLat1 <= maxLat2 && minLat2 <= maxLat1 && minLong1 <= maxLong2 && minLong2 <= maxLong1
+}
+
 type QuadTreeLeaf struct {
 	Location   Position               `json:"location"`
 	LocationID string                 `json:"locationID"`
 	Data       map[string]interface{} `json:"data"`
+	UpdatedAt  int64                  `json:"updatedAt,omitempty"` //Unix time in milliseconds of the last write
 }
 
-func NewQuadTreeLeaf(location Position, locationID string, data map[string]interface{}) *QuadTreeLeaf {
-	return &QuadTreeLeaf{Location: location, LocationID: locationID, Data: data}
+func NewQuadTreeLeaf(location Position, locationID string, data map[string]interface{}, updatedAt int64) *QuadTreeLeaf {
+	return &QuadTreeLeaf{Location: location, LocationID: locationID, Data: data, UpdatedAt: updatedAt}
 }
 
 func (q QuadTreeLeaf) GetLocation() Position {
@@ -101,176 +104,259 @@ func (q QuadTreeLeaf) GetLocationID() string {
 
 type QuadTree struct {
 	root          *QuadTreeNode
-	height        int
+	height        int           //Maximum depth of the nodes, beyond which they are not split
+	maxLeaves     int           //Number of leaves a node holds before it is split into quadrants
+	distance      DistanceModel //Measures the distances between locations
+	planar        bool          //Whether positions are y,x coordinates within arbitrary bounds rather than latitudes and longitudes
+	structureMtx  sync.RWMutex  //Held for reading by every operation and for writing while nodes are split or merged
 	locationIndex *concurrentMap
+	shapes        *shapeIndex //Polygons and lines, indexed apart from the locations as they may span many nodes
 }
 
-func NewQuadTree(height int) *QuadTree {
-	return &QuadTree{height: height,
+//DefaultMaxLeavesPerNode is the number of leaves a node holds before it is split, unless set with WithMaxLeavesPerNode
+const DefaultMaxLeavesPerNode = 32
+
+//QuadTreeOption configures a QuadTree created by NewQuadTree
+type QuadTreeOption func(q *QuadTree)
+
+//WithMaxLeavesPerNode sets the number of leaves a node holds before it is split into quadrants
+func WithMaxLeavesPerNode(maxLeaves int) QuadTreeOption {
+	return func(q *QuadTree) {
+		if maxLeaves > 0 {
+			q.maxLeaves = maxLeaves
+		}
+	}
+}
+
+//WithDistanceModel sets the model used to measure the distances between locations, which is Haversine by default
+func WithDistanceModel(model DistanceModel) QuadTreeOption {
+	return func(q *QuadTree) {
+		if model != nil {
+			q.distance = model
+		}
+	}
+}
+
+//WithPlanarBounds makes the tree hold x,y coordinates in metres within the given bounds rather than latitudes and
+//longitudes, measuring Euclidean distances between them. Positions take y as their latitude and x as their longitude.
+func WithPlanarBounds(minX, minY, maxX, maxY float64) QuadTreeOption {
+	return func(q *QuadTree) {
+		q.root = NewQuadTreeNode(NewRectangle(NewPosition(maxY, minX), NewPosition(minY, maxX)), nil, false, &map[string]*QuadTreeLeaf{}, nil)
+		q.distance = Planar
+		q.planar = true
+	}
+}
+
+//NewQuadTree returns an empty tree whose nodes are split into quadrants once they hold more than the maximum number
+//of leaves, down to maxDepth levels below the root, and merged back once their quadrants empty out.
+func NewQuadTree(maxDepth int, options ...QuadTreeOption) *QuadTree {
+	q := &QuadTree{height: maxDepth,
+		maxLeaves: DefaultMaxLeavesPerNode,
+		distance:  Haversine,
 		root: NewQuadTreeNode(
 			NewRectangle(NewPosition(90, -180), NewPosition(-90, 180)),
 			nil,
 			false,
-			nil,
+			&map[string]*QuadTreeLeaf{},
 			nil),
 		locationIndex: NewMap(),
 	}
+	for _, option := range options {
+		option(q)
+	}
+	q.shapes = newShapeIndex(q.root.boundingBox)
+	return q
 }
 
-func (q *QuadTree) Insert(locationID string, location Position, data map[string]interface{}) {
-	q.insert(locationID, location, data, true)
+//DistanceModel returns the model the tree measures distances with
+func (q *QuadTree) DistanceModel() DistanceModel {
+	return q.distance
 }
 
-func (q *QuadTree) insert(locationID string, location Position, data map[string]interface{}, safe bool) *QuadTreeNode {
-	var insert func(int, *QuadTreeNode) *QuadTreeNode
-	insert = func(depth int, cur *QuadTreeNode) *QuadTreeNode {
-		if depth <= q.height {
-			// We haven't reached target depth yet.
-			// Keep searching child nodes recursively.
-			return insert(depth+1, cur.findContainingChild(location))
-		} else {
-			//We are in Leaf. Add Location
-			if safe {
-				q.locationIndex.Lock(locationID)
-				defer q.locationIndex.UnLock(locationID)
-				cur.leavesMtx.Lock()
-				defer cur.leavesMtx.Unlock()
-			}
-			if cur.leaves == nil {
-				cur.leaves = &map[string]*QuadTreeLeaf{}
-			}
-			//*cur.leaves = append(*cur.leaves, *NewQuadTreeLeaf(Location, LocationID, ShardKey))
-			(*cur.leaves)[locationID] = NewQuadTreeLeaf(location, locationID, data)
-			q.locationIndex.SetUnsafe(locationID, cur)
-			return cur
-		}
-	}
-	node := insert(1, q.root)
-	return node
+//IsPlanar reports whether positions are y,x coordinates rather than latitudes and longitudes
+func (q *QuadTree) IsPlanar() bool {
+	return q.planar
 }
 
-func (q *QuadTree) Delete(locationID string) error {
-	node := q.locationIndex.Get(locationID)
-	if node == nil {
-		return quadrilleError.ErrNonExistingLocationDeleteAttempt
-	}
-	q.locationIndex.Lock(locationID)
-	defer q.locationIndex.UnLock(locationID)
-	node.leavesMtx.Lock()
-	defer node.leavesMtx.Unlock()
-	//Checking again as this might have changed due to concurrent code
-	if node = q.locationIndex.GetUnsafe(locationID); node == nil {
-		return quadrilleError.ErrNonExistingLocationDeleteAttempt
+//Contains returns true if the location lies within the bounds of the tree
+func (q *QuadTree) Contains(location GeoLocation) bool {
+	return isWithinBox(q.root.boundingBox, location)
+}
+
+//Returns the rectangles covering the box from the sw to the ne corner, which crosses the antimeridian if its
+//west edge is east of its east edge. Planar coordinates do not wrap, so their corners are merely reordered.
+func (q *QuadTree) splitBox(sw, ne GeoLocation) []Rectangle {
+	if q.planar {
+		return []Rectangle{NewRectangle(sw, ne)}
 	}
+	return splitAtAntimeridian(sw, ne)
+}
 
-	delete(*node.leaves, locationID)
-	q.locationIndex.DeleteUnsafe(locationID)
-	return nil
+//Returns the center of the box from the sw to the ne corner, see splitBox
+func (q *QuadTree) getBoxCenter(sw, ne GeoLocation) GeoLocation {
+	if q.planar {
+		return getMidPoint(sw, ne)
+	}
+	return getBoxCenter(sw, ne)
 }
 
-func (q *QuadTree) UpdateLocation(locationID string, location Position) error {
-	node := q.locationIndex.Get(locationID)
-	if node == nil {
-		return quadrilleError.ErrNonExistingLocationUpdateAttempt
+//Insert adds the location to the tree. Locations outside the bounds of the tree are ignored.
+func (q *QuadTree) Insert(locationID string, location Position, data map[string]interface{}, updatedAt int64) {
+	if !q.Contains(location) {
+		return
 	}
+	q.structureMtx.RLock()
 	q.locationIndex.Lock(locationID)
-	defer q.locationIndex.UnLock(locationID)
-	node.leavesMtx.Lock()
-	defer node.leavesMtx.Unlock()
-	//Checking again as this might have changed due to concurrent code
-	if node = q.locationIndex.GetUnsafe(locationID); node == nil {
-		return quadrilleError.ErrNonExistingLocationUpdateAttempt
+	node := q.insert(locationID, location, data, updatedAt)
+	q.locationIndex.UnLock(locationID)
+	full := q.isFull(node)
+	q.structureMtx.RUnlock()
+	if full {
+		q.split(node)
 	}
-	if isWithinBox(node.boundingBox, location) {
-		(*node.leaves)[locationID].Location = location
-	} else {
-		data := (*node.leaves)[locationID].Data
-		delete(*node.leaves, locationID)
-		q.locationIndex.DeleteUnsafe(locationID)
-		q.insert(locationID, location, data, false)
+}
+
+//Adds the leaf to the unsplit node containing the location, removing the leaf it replaces from its node.
+//The caller must hold the lock of the location and a read lock of the structure.
+func (q *QuadTree) insert(locationID string, location Position, data map[string]interface{}, updatedAt int64) *QuadTreeNode {
+	cur := q.root
+	for cur.children != nil {
+		cur = cur.findContainingChild(location)
 	}
-	return nil
+	if prev := q.locationIndex.GetUnsafe(locationID); prev != nil && prev != cur {
+		prev.leavesMtx.Lock()
+		removeLeaf(prev, locationID)
+		prev.leavesMtx.Unlock()
+	}
+	cur.leavesMtx.Lock()
+	defer cur.leavesMtx.Unlock()
+	(*cur.leaves)[locationID] = NewQuadTreeLeaf(location, locationID, data, updatedAt)
+	q.locationIndex.SetUnsafe(locationID, cur)
+	return cur
 }
 
-func (q *QuadTree) UpdateData(locationID string, data map[string]interface{}) error {
-	node := q.locationIndex.Get(locationID)
+func (q *QuadTree) Delete(locationID string) error {
+	q.structureMtx.RLock()
+	q.locationIndex.Lock(locationID)
+	node := q.locationIndex.GetUnsafe(locationID)
 	if node == nil {
-		return quadrilleError.ErrNonExistingLocationUpdateAttempt
+		q.locationIndex.UnLock(locationID)
+		q.structureMtx.RUnlock()
+		return quadrilleError.ErrNonExistingLocationDeleteAttempt
 	}
-	q.locationIndex.Lock(locationID)
-	defer q.locationIndex.UnLock(locationID)
 	node.leavesMtx.Lock()
-	defer node.leavesMtx.Unlock()
-	//Checking again as this might have changed due to concurrent code
-	if node = q.locationIndex.GetUnsafe(locationID); node == nil {
-		return quadrilleError.ErrNonExistingLocationUpdateAttempt
+	removeLeaf(node, locationID)
+	node.leavesMtx.Unlock()
+	q.locationIndex.DeleteUnsafe(locationID)
+	q.locationIndex.UnLock(locationID)
+	sparse := q.isSparse(node.parent)
+	q.structureMtx.RUnlock()
+	if sparse {
+		q.merge(node.parent)
 	}
-	(*node.leaves)[locationID].Data = data
 	return nil
 }
 
-func (q *QuadTree) Update(locationID string, location Position, data map[string]interface{}) error {
-	_, err := q.update(locationID, location, data)
-	return err
+func (q *QuadTree) UpdateLocation(locationID string, location Position, updatedAt int64) error {
+	return q.update(locationID, func(leaf *QuadTreeLeaf) {
+		leaf.Location = location
+		leaf.UpdatedAt = updatedAt
+	})
 }
 
-func (q *QuadTree) update(locationID string, location Position, data map[string]interface{}) (*QuadTreeNode, error) {
-	node := q.locationIndex.Get(locationID)
-	if node == nil {
-		return nil, quadrilleError.ErrNonExistingLocationUpdateAttempt
-	}
+func (q *QuadTree) UpdateData(locationID string, data map[string]interface{}, updatedAt int64) error {
+	return q.update(locationID, func(leaf *QuadTreeLeaf) {
+		leaf.Data = data
+		leaf.UpdatedAt = updatedAt
+	})
+}
+
+func (q *QuadTree) Update(locationID string, location Position, data map[string]interface{}, updatedAt int64) error {
+	return q.update(locationID, func(leaf *QuadTreeLeaf) {
+		leaf.Location = location
+		leaf.Data = data
+		leaf.UpdatedAt = updatedAt
+	})
+}
+
+//Applies the change to the leaf of the location, moving the leaf to the node containing its new position if it left
+//its node. The node it left is merged with its siblings and the node it moved to is split as needed.
+func (q *QuadTree) update(locationID string, change func(leaf *QuadTreeLeaf)) error {
+	q.structureMtx.RLock()
 	q.locationIndex.Lock(locationID)
-	defer q.locationIndex.UnLock(locationID)
-	node.leavesMtx.Lock()
-	defer node.leavesMtx.Unlock()
-	//Checking again as this might have changed due to concurrent code
-	if node = q.locationIndex.GetUnsafe(locationID); node == nil {
-		return nil, quadrilleError.ErrNonExistingLocationUpdateAttempt
-	}
-	updatedNode := node
-	if isWithinBox(node.boundingBox, location) {
-		(*node.leaves)[locationID].Location = location
-		(*node.leaves)[locationID].Data = data
+	from := q.locationIndex.GetUnsafe(locationID)
+	if from == nil {
+		q.locationIndex.UnLock(locationID)
+		q.structureMtx.RUnlock()
+		return quadrilleError.ErrNonExistingLocationUpdateAttempt
+	}
+	from.leavesMtx.Lock()
+	leaf := *(*from.leaves)[locationID]
+	change(&leaf)
+	if !q.Contains(leaf.GetLocation()) {
+		from.leavesMtx.Unlock()
+		q.locationIndex.UnLock(locationID)
+		q.structureMtx.RUnlock()
+		return quadrilleError.ErrPositionOutOfBounds
+	}
+	to := from
+	if isWithinBox(from.boundingBox, leaf.GetLocation()) {
+		*(*from.leaves)[locationID] = leaf
+		from.leavesMtx.Unlock()
 	} else {
-		delete(*node.leaves, locationID)
-		q.locationIndex.DeleteUnsafe(locationID)
-		updatedNode = q.insert(locationID, location, data, false)
+		removeLeaf(from, locationID)
+		from.leavesMtx.Unlock()
+		to = q.insert(locationID, leaf.Location, leaf.Data, leaf.UpdatedAt)
+	}
+	q.locationIndex.UnLock(locationID)
+	full, sparse := q.isFull(to), to != from && q.isSparse(from.parent)
+	q.structureMtx.RUnlock()
+	if full {
+		q.split(to)
 	}
-	return updatedNode, nil
+	if sparse {
+		q.merge(from.parent)
+	}
+	return nil
 }
 
 func (q *QuadTree) Get(locationID string) (QuadTreeLeaf, error) {
-	if node := q.locationIndex.Get(locationID); node == nil {
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	node := q.locationIndex.Get(locationID)
+	if node == nil {
 		return QuadTreeLeaf{}, quadrilleError.ErrLocationNotFound
 	}
-	node := q.locationIndex.Get(locationID)
 	node.leavesMtx.RLock()
 	defer node.leavesMtx.RUnlock()
 	leaves := node.leaves
 	return *(*leaves)[locationID], nil
 }
 
-func filterLeafsByDistance(leaves map[string]*QuadTreeLeaf, location GeoLocation, distanceInMetres int) []QuadTreeNeighborResult {
+//Returns the leaves within distanceInMetres of the location accepted by matches. The caller must hold the lock of the leaves.
+func filterLeafsByDistance(leaves map[string]*QuadTreeLeaf, location GeoLocation, distanceInMetres int, matches leafMatcher, model DistanceModel) []QuadTreeNeighborResult {
 	filteredLeaves := []QuadTreeNeighborResult{}
 	for _, leaf := range leaves {
-		distance := location.DistanceTo(leaf.GetLocation())
-		if distance <= float64(distanceInMetres) {
+		distance := model.Distance(location, leaf.GetLocation())
+		if distance <= float64(distanceInMetres) && matches(leaf) {
 			filteredLeaves = append(filteredLeaves, *NewQuadTreeNeighborResult(*leaf, distance))
 		}
 	}
 	return filteredLeaves
 }
 
-func getNearbyChildLeaves(q QuadTreeNode, location GeoLocation, radiusInMetres int) []QuadTreeNeighborResult {
+func getNearbyChildLeaves(q *QuadTreeNode, location GeoLocation, radiusInMetres int, matches leafMatcher, model DistanceModel) []QuadTreeNeighborResult {
 	leaves := []QuadTreeNeighborResult{}
-	var addMatchingLeaves func(node QuadTreeNode)
-	addMatchingLeaves = func(node QuadTreeNode) {
+	var addMatchingLeaves func(node *QuadTreeNode)
+	addMatchingLeaves = func(node *QuadTreeNode) {
 		if node.leaves != nil {
-			leaves = append(leaves, filterLeafsByDistance(*node.leaves, location, radiusInMetres)...)
+			node.leavesMtx.RLock()
+			leaves = append(leaves, filterLeafsByDistance(*node.leaves, location, radiusInMetres, matches, model)...)
+			node.leavesMtx.RUnlock()
 		} else if node.children != nil {
 			for _, child := range node.children {
-				if location.IntersectsRectangle(child.boundingBox, radiusInMetres) {
-					addMatchingLeaves(*child)
+				if model.MinDistanceToRectangle(location, child.boundingBox) <= float64(radiusInMetres) {
+					addMatchingLeaves(child)
 				}
 			}
 		}
@@ -279,27 +365,19 @@ func getNearbyChildLeaves(q QuadTreeNode, location GeoLocation, radiusInMetres i
 	return leaves
 }
 
-func (q *QuadTreeNode) findNeighbourQuadMatches(location GeoLocation, radiusInMetres int) []QuadTreeNeighborResult {
+//Climbs from the node containing location, searching the siblings at each level which intersect the circle.
+//Every node outside the circle's path up is a sibling of one of its ancestors, so once an ancestor contains
+//the whole circle all of the matches have been found. A level without intersecting siblings is no reason to
+//stop, as the circle may still cross an edge of the ancestor.
+func (q *QuadTreeNode) findNeighbourQuadMatches(location Position, radiusInMetres int, matches leafMatcher, model DistanceModel) []QuadTreeNeighborResult {
 	matchedLeaves := []QuadTreeNeighborResult{}
+	radius := float64(radiusInMetres)
 	prevNode, curNode := q, q.parent
-	for true {
-		//If not reached root
-		if curNode != nil {
-			childsExplored := 0
-			for _, child := range curNode.children {
-				if *child != *prevNode && location.IntersectsRectangle(child.boundingBox, radiusInMetres) {
-					leaves := getNearbyChildLeaves(*child, location, radiusInMetres)
-					if len(leaves) > 0 {
-						matchedLeaves = append(matchedLeaves, leaves...)
-					}
-					childsExplored++
-				}
+	for curNode != nil && model.MinDistanceToBoxEdge(location, prevNode.boundingBox) <= radius {
+		for _, child := range curNode.children {
+			if child != prevNode && model.MinDistanceToRectangle(location, child.boundingBox) <= radius {
+				matchedLeaves = append(matchedLeaves, getNearbyChildLeaves(child, location, radiusInMetres, matches, model)...)
 			}
-			if childsExplored == 0 {
-				break
-			}
-		} else {
-			break
 		}
 		prevNode = curNode
 		curNode = curNode.parent
@@ -307,18 +385,102 @@ func (q *QuadTreeNode) findNeighbourQuadMatches(location GeoLocation, radiusInMe
 	return matchedLeaves
 }
 
-func (q *QuadTree) GetNearbyLocations(location Position, radiusInMetres, limit int) []QuadTreeNeighborResult {
+//Reports whether a leaf satisfies the non spatial constraints of a query
+type leafMatcher func(leaf *QuadTreeLeaf) bool
+
+//Returns a leafMatcher accepting the leaves whose data matches the filter and which were written at or after minUpdatedAt
+func newLeafMatcher(filter Filter, minUpdatedAt int64) leafMatcher {
+	return func(leaf *QuadTreeLeaf) bool {
+		return leaf.UpdatedAt >= minUpdatedAt && filter.Matches(leaf.Data)
+	}
+}
+
+//GetNearbyLocations returns the locations within radiusInMetres whose data matches the filter, nearest first.
+//Locations last written before minUpdatedAt, in unix milliseconds, are excluded; 0 includes all of them.
+//The filter is applied while walking the tree so that the limit only counts matching locations.
+func (q *QuadTree) GetNearbyLocations(location Position, radiusInMetres, limit int, filter Filter, minUpdatedAt int64) []QuadTreeNeighborResult {
+	return q.GetNearbyLocationsWithAltitude(location, radiusInMetres, limit, filter, minUpdatedAt, AltitudeQuery{})
+}
+
+//GetNearbyLocationsWithAltitude is GetNearbyLocations restricted to the altitude band of the query, measuring
+//distances including the difference in altitude if it asks for 3D distances
+func (q *QuadTree) GetNearbyLocationsWithAltitude(location Position, radiusInMetres, limit int, filter Filter, minUpdatedAt int64, altitude AltitudeQuery) []QuadTreeNeighborResult {
 	matchedLeaves := []QuadTreeNeighborResult{}
-	if q.root != nil {
-		curNode := q.root
-		for curNode.children != nil {
-			curNode = curNode.findContainingChild(location)
+	matches := altitude.matcher(newLeafMatcher(filter, minUpdatedAt))
+	model := q.distance
+	if altitude.Use3D {
+		model = WithAltitude(model)
+	}
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	if !q.Contains(location) {
+		//Search down from the root, as there is no node containing the location to climb from
+		return sortAndLimit(getNearbyChildLeaves(q.root, location, radiusInMetres, matches, model), limit)
+	}
+	curNode := q.root
+	for curNode.children != nil {
+		curNode = curNode.findContainingChild(location)
+	}
+	curNode.leavesMtx.RLock()
+	matchedLeaves = append(matchedLeaves, filterLeafsByDistance(*curNode.leaves, location, radiusInMetres, matches, model)...)
+	curNode.leavesMtx.RUnlock()
+	matchedLeaves = append(matchedLeaves, curNode.findNeighbourQuadMatches(location, radiusInMetres, matches, model)...)
+	return sortAndLimit(matchedLeaves, limit)
+}
+
+//Walks the nodes whose bounding box satisfies intersects, calling visit with each of their leaves until it returns false.
+//Returns false if the walk was stopped. The caller must hold a lock of the structure.
+func visitLeaves(node *QuadTreeNode, intersects func(Rectangle) bool, visit func(*QuadTreeLeaf) bool) bool {
+	if node.leaves != nil {
+		node.leavesMtx.RLock()
+		defer node.leavesMtx.RUnlock()
+		for _, leaf := range *node.leaves {
+			if !visit(leaf) {
+				return false
+			}
 		}
-		if curNode.leaves != nil {
-			matchedLeaves = append(matchedLeaves, filterLeafsByDistance(*curNode.leaves, location, radiusInMetres)...)
+		return true
+	}
+	if node.children != nil {
+		for _, child := range node.children {
+			if intersects(child.boundingBox) && !visitLeaves(child, intersects, visit) {
+				return false
+			}
 		}
-		matchedLeaves = append(matchedLeaves, curNode.findNeighbourQuadMatches(location, radiusInMetres)...)
 	}
+	return true
+}
+
+//Walks the nodes whose bounding box satisfies intersects and returns the leaves accepted by match along with their distance
+func (q *QuadTree) findMatchingLeaves(intersects func(Rectangle) bool, match func(*QuadTreeLeaf) (float64, bool)) []QuadTreeNeighborResult {
+	matchedLeaves := []QuadTreeNeighborResult{}
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	visitLeaves(q.root, intersects, func(leaf *QuadTreeLeaf) bool {
+		if distance, ok := match(leaf); ok {
+			matchedLeaves = append(matchedLeaves, *NewQuadTreeNeighborResult(*leaf, distance))
+		}
+		return true
+	})
+	return matchedLeaves
+}
+
+//Walks the nodes whose bounding box satisfies intersects and counts the leaves accepted by matches,
+//stopping once limit of them are found. A limit of 0 counts all of them.
+func (q *QuadTree) countMatchingLeaves(intersects func(Rectangle) bool, matches leafMatcher, limit int) int {
+	count := 0
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	visitLeaves(q.root, intersects, func(leaf *QuadTreeLeaf) bool {
+		if matches(leaf) {
+			count++
+		}
+		return limit <= 0 || count < limit
+	})
+	return count
+}
+
+func sortAndLimit(matchedLeaves []QuadTreeNeighborResult, limit int) []QuadTreeNeighborResult {
 	sort.Sort(byDistance(matchedLeaves))
 	if len(matchedLeaves) > limit {
 		return matchedLeaves[:limit]
@@ -326,12 +488,127 @@ func (q *QuadTree) GetNearbyLocations(location Position, radiusInMetres, limit i
 	return matchedLeaves
 }
 
+//CountNearbyLocations counts the locations GetNearbyLocationsWithAltitude would return without a limit, stopping once
+//limit of them are found so that a limit of 1 tells whether there is any. A limit of 0 counts all of them.
+//Neither results nor distances to sort them by are kept.
+func (q *QuadTree) CountNearbyLocations(location Position, radiusInMetres int, filter Filter, minUpdatedAt int64, altitude AltitudeQuery, limit int) int {
+	matches := altitude.matcher(newLeafMatcher(filter, minUpdatedAt))
+	model := q.distance
+	if altitude.Use3D {
+		model = WithAltitude(model)
+	}
+	radius := float64(radiusInMetres)
+	return q.countMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			return model.MinDistanceToRectangle(location, nodeBox) <= radius
+		},
+		func(leaf *QuadTreeLeaf) bool {
+			return model.Distance(location, leaf.GetLocation()) <= radius && matches(leaf)
+		},
+		limit)
+}
+
+//GetLocationsInBox returns the locations lying within the rectangle formed by the sw and ne corners,
+//excluding those last written before minUpdatedAt. A sw longitude greater than the ne longitude denotes
+//a box crossing the antimeridian. Results are sorted by their distance from the center of the rectangle.
+func (q *QuadTree) GetLocationsInBox(sw, ne Position, limit int, minUpdatedAt int64) []QuadTreeNeighborResult {
+	boxes := q.splitBox(sw, ne)
+	center := q.getBoxCenter(sw, ne)
+	matchedLeaves := q.findMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			return boxesIntersectAny(boxes, nodeBox)
+		},
+		func(leaf *QuadTreeLeaf) (float64, bool) {
+			return q.distance.Distance(center, leaf.GetLocation()), leaf.UpdatedAt >= minUpdatedAt && isWithinAnyBox(boxes, leaf.GetLocation())
+		})
+	return sortAndLimit(matchedLeaves, limit)
+}
+
+//CountLocationsInBox counts the locations GetLocationsInBox would return without a limit, stopping once limit of them
+//are found. A limit of 0 counts all of them.
+func (q *QuadTree) CountLocationsInBox(sw, ne Position, minUpdatedAt int64, limit int) int {
+	boxes := q.splitBox(sw, ne)
+	return q.countMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			return boxesIntersectAny(boxes, nodeBox)
+		},
+		func(leaf *QuadTreeLeaf) bool {
+			return leaf.UpdatedAt >= minUpdatedAt && isWithinAnyBox(boxes, leaf.GetLocation())
+		},
+		limit)
+}
+
+//GetLocationsInGeohash returns the locations whose geohash starts with the given geohash.
+//Results are sorted by their distance from the center of the geohash.
+func (q *QuadTree) GetLocationsInGeohash(geohash string, limit int) ([]QuadTreeNeighborResult, error) {
+	if q.planar {
+		return nil, quadrilleError.ErrGeohashOnPlanar
+	}
+	bounds, err := GeohashBounds(geohash)
+	if err != nil {
+		return nil, err
+	}
+	geohash = strings.ToLower(geohash)
+	center := getMidPoint(bounds.Corner1(), bounds.Corner2())
+	matchedLeaves := q.findMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			return boxesIntersect(nodeBox, bounds)
+		},
+		func(leaf *QuadTreeLeaf) (float64, bool) {
+			//Comparing geohashes rather than the bounds excludes the locations on the north and east edges, which belong to the neighbouring geohashes
+			return q.distance.Distance(center, leaf.GetLocation()), Geohash(leaf.GetLocation(), len(geohash)) == geohash
+		})
+	return sortAndLimit(matchedLeaves, limit), nil
+}
+
+//GetLocationsInPolygon returns the locations lying within any of the given polygons.
+//Results are sorted by their distance from the center of the polygons' bounding box.
+func (q *QuadTree) GetLocationsInPolygon(polygons []Polygon, limit int) []QuadTreeNeighborResult {
+	if len(polygons) == 0 {
+		return []QuadTreeNeighborResult{}
+	}
+	bounds := getPolygonsBoundingBox(polygons)
+	center := getMidPoint(bounds.Corner1(), bounds.Corner2())
+	matchedLeaves := q.findMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			return polygonsIntersectBox(polygons, bounds, nodeBox)
+		},
+		func(leaf *QuadTreeLeaf) (float64, bool) {
+			if !polygonsContain(polygons, leaf.GetLocation()) {
+				return 0, false
+			}
+			return q.distance.Distance(center, leaf.GetLocation()), true
+		})
+	return sortAndLimit(matchedLeaves, limit)
+}
+
+//CountLocationsInPolygon counts the locations GetLocationsInPolygon would return without a limit, stopping once limit
+//of them are found. A limit of 0 counts all of them.
+func (q *QuadTree) CountLocationsInPolygon(polygons []Polygon, limit int) int {
+	if len(polygons) == 0 {
+		return 0
+	}
+	bounds := getPolygonsBoundingBox(polygons)
+	return q.countMatchingLeaves(
+		func(nodeBox Rectangle) bool {
+			return polygonsIntersectBox(polygons, bounds, nodeBox)
+		},
+		func(leaf *QuadTreeLeaf) bool {
+			return polygonsContain(polygons, leaf.GetLocation())
+		},
+		limit)
+}
+
 type QuadTreeSnapshot map[string]QuadTreeLeaf
 
-func (q QuadTree) GetAllLocations() QuadTreeSnapshot {
+func (q *QuadTree) GetAllLocations() QuadTreeSnapshot {
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
 	var snapShot = make(map[string]QuadTreeLeaf)
 	for locationID, qNode := range q.locationIndex.GetAllKeyVal() {
+		qNode.leavesMtx.RLock()
 		snapShot[locationID] = *(*qNode.leaves)[locationID]
+		qNode.leavesMtx.RUnlock()
 	}
 	return snapShot
 }
@@ -1,7 +1,13 @@
 package ds
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/quadrille/quadrille/core/errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
 	"testing"
 )
 
@@ -12,8 +18,8 @@ import (
 var q = NewQuadTree(16)
 
 func init() {
-	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{})
-	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{})
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{}, 0)
 }
 
 func TestQuadTree_Get(t *testing.T) {
@@ -37,7 +43,7 @@ func TestQuadTree_Get(t *testing.T) {
 }
 
 func TestQuadTree_GetNearbyLocations(t *testing.T) {
-	neighbors := q.GetNearbyLocations(*NewPosition(12.9639716, 77.7120424), 1000, 10)
+	neighbors := q.GetNearbyLocations(*NewPosition(12.9639716, 77.7120424), 1000, 10, nil, 0)
 	expectedNeighborCount := 2
 	if len(neighbors) != expectedNeighborCount {
 		t.Fatalf("Expected %d neighbors, got %d", expectedNeighborCount, len(neighbors))
@@ -55,3 +61,686 @@ func TestQuadTree_Delete(t *testing.T) {
 		t.Fatalf("Expected ErrLocationNotFound, got %v", err)
 	}
 }
+
+func TestQuadTree_GetLocationsInBox(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{}, 0)
+	q.Insert("loc00003", *NewPosition(12.9958069, 77.6942081), map[string]interface{}{}, 0)
+
+	locations := q.GetLocationsInBox(*NewPosition(12.96, 77.71), *NewPosition(12.97, 77.72), 10, 0)
+	expectedCount := 2
+	if len(locations) != expectedCount {
+		t.Fatalf("Expected %d locations, got %d", expectedCount, len(locations))
+	}
+
+	locations = q.GetLocationsInBox(*NewPosition(12.96, 77.71), *NewPosition(12.97, 77.72), 1, 0)
+	if len(locations) != 1 {
+		t.Fatalf("Expected limit of %d to be applied, got %d", 1, len(locations))
+	}
+
+	locations = q.GetLocationsInBox(*NewPosition(-10, -10), *NewPosition(10, 10), 10, 0)
+	if len(locations) != 0 {
+		t.Fatalf("Expected no locations, got %d", len(locations))
+	}
+}
+
+func TestQuadTree_GetLocationsInPolygon(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{}, 0)
+	q.Insert("loc00003", *NewPosition(12.9958069, 77.6942081), map[string]interface{}{}, 0)
+
+	//Triangle containing loc00001 but not loc00002
+	triangle := *NewPolygon([]Position{*NewPosition(12.965, 77.71), *NewPosition(12.97, 77.71), *NewPosition(12.965, 77.72)})
+	locations := q.GetLocationsInPolygon([]Polygon{triangle}, 10)
+	if len(locations) != 1 || locations[0].Leaf.LocationID != "loc00001" {
+		t.Fatalf("Expected only loc00001 inside polygon, got %v", locations)
+	}
+
+	square := *NewPolygon([]Position{*NewPosition(12.99, 77.69), *NewPosition(12.99, 77.70), *NewPosition(13, 77.70), *NewPosition(13, 77.69)})
+	locations = q.GetLocationsInPolygon([]Polygon{triangle, square}, 10)
+	if len(locations) != 2 {
+		t.Fatalf("Expected 2 locations inside multipolygon, got %d", len(locations))
+	}
+}
+
+func TestQuadTree_GetNearestLocations(t *testing.T) {
+	q := NewQuadTree(16)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		q.Insert(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*20-10, rnd.Float64()*20+70), map[string]interface{}{}, 0)
+	}
+	location := *NewPosition(1.5, 80.5)
+
+	allDistances := []float64{}
+	for _, leaf := range q.GetAllLocations() {
+		allDistances = append(allDistances, location.DistanceTo(leaf.GetLocation(), Haversine))
+	}
+	sort.Float64s(allDistances)
+
+	k := 5
+	nearest := q.GetNearestLocations(location, k, 0)
+	if len(nearest) != k {
+		t.Fatalf("Expected %d nearest locations, got %d", k, len(nearest))
+	}
+	for i, result := range nearest {
+		if result.Distance != allDistances[i] {
+			t.Fatalf("Expected nearest location %d at %fm, got %fm", i, allDistances[i], result.Distance)
+		}
+	}
+
+	maxDistance := int(allDistances[2]) + 1
+	nearest = q.GetNearestLocations(location, k, maxDistance)
+	if len(nearest) != 3 {
+		t.Fatalf("Expected %d locations within %dm, got %d", 3, maxDistance, len(nearest))
+	}
+}
+
+func TestQuadTree_GetNearbyLocationsWithFilter(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{"status": "busy"}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{"status": "available"}, 0)
+
+	filter, _ := ParseFilter(`{"status":"available"}`)
+	neighbors := q.GetNearbyLocations(*NewPosition(12.9660637, 77.7157481), 1000, 1, filter, 0)
+	if len(neighbors) != 1 || neighbors[0].Leaf.LocationID != "loc00002" {
+		t.Fatalf("Expected the filter to be applied before the limit, got %v", neighbors)
+	}
+}
+
+func TestQuadTree_FreshnessConstraint(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{}, 1000)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{}, 5000)
+
+	neighbors := q.GetNearbyLocations(*NewPosition(12.9660637, 77.7157481), 1000, 10, nil, 2000)
+	if len(neighbors) != 1 || neighbors[0].Leaf.LocationID != "loc00002" || neighbors[0].Leaf.UpdatedAt != 5000 {
+		t.Fatalf("Expected only the fresh location, got %v", neighbors)
+	}
+	locations := q.GetLocationsInBox(*NewPosition(12.96, 77.71), *NewPosition(12.97, 77.72), 10, 2000)
+	if len(locations) != 1 || locations[0].Leaf.LocationID != "loc00002" {
+		t.Fatalf("Expected only the fresh location, got %v", locations)
+	}
+
+	q.UpdateLocation("loc00001", *NewPosition(12.9660638, 77.7157482), 6000)
+	if leaf, _ := q.Get("loc00001"); leaf.UpdatedAt != 6000 {
+		t.Fatalf("Expected updateloc to record the write time, got %d", leaf.UpdatedAt)
+	}
+	if locations = q.GetLocationsInBox(*NewPosition(12.96, 77.71), *NewPosition(12.97, 77.72), 10, 2000); len(locations) != 2 {
+		t.Fatalf("Expected both locations to be fresh, got %v", locations)
+	}
+}
+
+func TestQuadTree_Aggregate(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{"fare": 100.0}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{"fare": 300.0}, 0)
+	q.Insert("loc00003", *NewPosition(-33.8688, 151.2093), map[string]interface{}{}, 0)
+	q.Insert("loc00004", *NewPosition(51.5074, -0.1278), map[string]interface{}{"fare": 50.0}, 0)
+
+	//Depth 1 splits the world into quadrants, of which London lies outside the box
+	cells := q.Aggregate(*NewPosition(-60, 0), *NewPosition(60, 180), 1, "fare")
+	if len(cells) != 2 {
+		t.Fatalf("Expected 2 cells, got %v", cells)
+	}
+	if cells[0].Count != 1 || cells[0].Sum != nil || cells[0].MinLat != -90 {
+		t.Fatalf("Expected the south east quadrant to hold Sydney without fares, got %+v", cells[0])
+	}
+	if cells[1].Count != 2 || *cells[1].Sum != 400 || *cells[1].Avg != 200 {
+		t.Fatalf("Expected the north east quadrant to hold both Bangalore locations, got %+v", cells[1])
+	}
+
+	//Depths beyond the tree height are clamped to the leaf nodes
+	cells = q.Aggregate(*NewPosition(12.96, 77.71), *NewPosition(12.97, 77.72), 100, "")
+	total := 0
+	for _, cell := range cells {
+		total += cell.Count
+		if cell.MaxLat-cell.MinLat > 0.01 {
+			t.Fatalf("Expected leaf level cells, got %+v", cell)
+		}
+	}
+	if total != 2 {
+		t.Fatalf("Expected 2 locations across the cells, got %v", cells)
+	}
+}
+
+func TestQuadTree_GetClusters(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{}, 0)
+	q.Insert("loc00003", *NewPosition(12.9958069, 77.6942081), map[string]interface{}{}, 0)
+	q.Insert("loc00004", *NewPosition(51.5074, -0.1278), map[string]interface{}{}, 0)
+
+	clusters := q.GetClusters(*NewPosition(0, 60), *NewPosition(30, 90), 3, 2)
+	if len(clusters) != 1 || clusters[0].Count != 3 || len(clusters[0].SampleIDs) != 2 || clusters[0].SampleIDs[0] != "loc00001" {
+		t.Fatalf("Expected a single cluster of the Bangalore locations, got %+v", clusters)
+	}
+	if math.Abs(clusters[0].Lat-12.9756103) > 1e-6 {
+		t.Fatalf("Expected the cluster at the centroid, got %f", clusters[0].Lat)
+	}
+
+	//Panning such that the viewport only partially covers the cluster's node must not change the cluster
+	panned := q.GetClusters(*NewPosition(12.99, 77.70), *NewPosition(40, 120), 3, 2)
+	if len(panned) != 1 || panned[0].Count != clusters[0].Count || panned[0].Lat != clusters[0].Lat {
+		t.Fatalf("Expected the cluster to be stable while panning, got %+v", panned)
+	}
+
+	//Zooming in splits the locations into smaller clusters
+	if clusters = q.GetClusters(*NewPosition(0, 60), *NewPosition(30, 90), 12, 2); len(clusters) < 2 {
+		t.Fatalf("Expected the Bangalore locations to split at zoom 12, got %+v", clusters)
+	}
+}
+
+func TestQuadTree_GetLocationsInGeohash(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("loc00001", *NewPosition(12.9660637, 77.7157481), map[string]interface{}{}, 0)
+	q.Insert("loc00002", *NewPosition(12.9649603, 77.7164898), map[string]interface{}{}, 0)
+	q.Insert("loc00003", *NewPosition(12.9958069, 77.6942081), map[string]interface{}{}, 0)
+	q.Insert("loc00004", *NewPosition(51.5074, -0.1278), map[string]interface{}{}, 0)
+
+	geohash := Geohash(*NewPosition(12.9660637, 77.7157481), 6)
+	locations, err := q.GetLocationsInGeohash(geohash, 10)
+	if err != nil || len(locations) != 2 {
+		t.Fatalf("Expected the 2 locations in %s, got %v, %v", geohash, locations, err)
+	}
+	for _, location := range locations {
+		if Geohash(location.Leaf.GetLocation(), 6) != geohash {
+			t.Fatalf("Expected %s to lie in %s", location.Leaf.LocationID, geohash)
+		}
+	}
+	if locations, _ = q.GetLocationsInGeohash(geohash[:3], 10); len(locations) != 3 {
+		t.Fatalf("Expected the 3 Bangalore locations in %s, got %v", geohash[:3], locations)
+	}
+	if _, err = q.GetLocationsInGeohash("tdr1a", 10); err != errors.ErrInvalidGeohash {
+		t.Fatalf("Expected %v, got %v", errors.ErrInvalidGeohash, err)
+	}
+}
+
+func TestQuadTree_GetLocationsAlongRoute(t *testing.T) {
+	q := NewQuadTree(16)
+	//A route heading east along latitude 12.97 and then north along longitude 77.75
+	route := []Position{*NewPosition(12.97, 77.70), *NewPosition(12.97, 77.75), *NewPosition(13.02, 77.75)}
+	q.Insert("start", *NewPosition(12.9705, 77.701), map[string]interface{}{}, 0)
+	q.Insert("corner", *NewPosition(12.969, 77.7505), map[string]interface{}{}, 0)
+	q.Insert("north", *NewPosition(13.01, 77.7512), map[string]interface{}{}, 0)
+	q.Insert("middle", *NewPosition(12.9712, 77.72), map[string]interface{}{}, 0)
+	q.Insert("far", *NewPosition(12.99, 77.72), map[string]interface{}{}, 0)
+
+	results := q.GetLocationsAlongRoute(route, 200, 10)
+	expected := []string{"start", "middle", "corner", "north"}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d locations along the route, got %v", len(expected), results)
+	}
+	for i, result := range results {
+		if result.Leaf.LocationID != expected[i] {
+			t.Fatalf("Expected %s at %d, got %s", expected[i], i, result.Leaf.LocationID)
+		}
+		if result.Distance > 200 {
+			t.Fatalf("Expected %s within 200m of the route, got %f", result.Leaf.LocationID, result.Distance)
+		}
+	}
+	//The middle location is ~133m north of the route, 0.02 degrees of longitude from its start
+	if math.Abs(results[1].Distance-133) > 2 || math.Abs(results[1].DistanceAlongRoute-2167) > 5 {
+		t.Fatalf("Expected middle ~133m off and ~2167m along the route, got %+v", results[1])
+	}
+
+	if _, err := ParseRoute([]byte(`{"type":"LineString","coordinates":[[77.70,12.97],[77.75,12.97]]}`)); err != nil {
+		t.Fatalf("Expected a valid GeoJSON route, got %v", err)
+	}
+	if _, err := ParseRoute([]byte(`[{"lat":12.97,"lon":77.70}]`)); err != errors.ErrInvalidRoute {
+		t.Fatalf("Expected %v, got %v", errors.ErrInvalidRoute, err)
+	}
+}
+
+func TestQuadTree_GetNearbyLocationsMatchesBruteForce(t *testing.T) {
+	q := NewQuadTree(16)
+	//Just across the 90th meridian, an edge between nodes whose nearest common ancestor is a quadrant of the root
+	q.Insert("across", *NewPosition(10, 90.005), map[string]interface{}{}, 0)
+	if neighbors := q.GetNearbyLocations(*NewPosition(10, 89.999), 1000, 10, nil, 0); len(neighbors) != 1 {
+		t.Fatalf("Expected the location across the node edge to be found, got %v", neighbors)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		q.Insert(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*2+12, rnd.Float64()*2+77), map[string]interface{}{}, 0)
+	}
+	for i := 0; i < 300; i++ {
+		q.Insert(fmt.Sprintf("world%05d", i), *NewPosition(rnd.Float64()*160-80, rnd.Float64()*360-180), map[string]interface{}{}, 0)
+	}
+	allLocations := q.GetAllLocations()
+
+	for i := 0; i < 200; i++ {
+		var location Position
+		var radius int
+		if i%2 == 0 {
+			location, radius = *NewPosition(rnd.Float64()*2+12, rnd.Float64()*2+77), rnd.Intn(50000)+1
+		} else {
+			location, radius = *NewPosition(rnd.Float64()*160-80, rnd.Float64()*360-180), rnd.Intn(3000000)+1
+		}
+		expected := map[string]bool{}
+		for locationID, leaf := range allLocations {
+			if location.DistanceTo(leaf.GetLocation(), Haversine) <= float64(radius) {
+				expected[locationID] = true
+			}
+		}
+		neighbors := q.GetNearbyLocations(location, radius, len(allLocations), nil, 0)
+		if len(neighbors) != len(expected) {
+			t.Fatalf("Expected %d locations within %dm of %v, got %d", len(expected), radius, location, len(neighbors))
+		}
+		for _, neighbor := range neighbors {
+			if !expected[neighbor.Leaf.LocationID] {
+				t.Fatalf("Unexpected location %s within %dm of %v", neighbor.Leaf.LocationID, radius, location)
+			}
+		}
+	}
+}
+
+func TestQuadTree_AntimeridianAndPoles(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("suva", *NewPosition(-18.14, 178.44), map[string]interface{}{}, 0)
+	q.Insert("taveuni", *NewPosition(-16.85, -179.97), map[string]interface{}{}, 0)
+	q.Insert("alert", *NewPosition(82.5, -62.35), map[string]interface{}{}, 0)
+	q.Insert("pole", *NewPosition(89.99, 120), map[string]interface{}{}, 0)
+	q.Insert("svalbard", *NewPosition(89.98, -60), map[string]interface{}{}, 0)
+
+	//Taveuni lies ~170km east of Suva across the antimeridian
+	neighbors := q.GetNearbyLocations(*NewPosition(-17.5, 179.9), 200000, 10, nil, 0)
+	if len(neighbors) != 2 || neighbors[0].Leaf.LocationID != "taveuni" {
+		t.Fatalf("Expected taveuni and suva across the antimeridian, got %v", neighbors)
+	}
+	nearest := q.GetNearestLocations(*NewPosition(-16.85, 179.99), 1, 0)
+	if len(nearest) != 1 || nearest[0].Leaf.LocationID != "taveuni" || nearest[0].Distance > 5000 {
+		t.Fatalf("Expected taveuni to be nearest across the antimeridian, got %v", nearest)
+	}
+
+	//Both locations lie within 5km of the pole, on opposite sides of it
+	neighbors = q.GetNearbyLocations(*NewPosition(89.99, -60), 5000, 10, nil, 0)
+	if len(neighbors) != 2 || neighbors[0].Leaf.LocationID != "svalbard" || neighbors[1].Leaf.LocationID != "pole" {
+		t.Fatalf("Expected svalbard and pole over the pole, got %v", neighbors)
+	}
+
+	locations := q.GetLocationsInBox(*NewPosition(-20, 178), *NewPosition(-15, -179), 10, 0)
+	if len(locations) != 2 {
+		t.Fatalf("Expected 2 locations within a box crossing the antimeridian, got %v", locations)
+	}
+	if locations = q.GetLocationsInBox(*NewPosition(-20, -179), *NewPosition(-15, 178), 10, 0); len(locations) != 0 {
+		t.Fatalf("Expected no locations within the box excluding the antimeridian, got %v", locations)
+	}
+	if cells := q.Aggregate(*NewPosition(-20, 178), *NewPosition(-15, -179), 16, ""); len(cells) != 2 {
+		t.Fatalf("Expected 2 cells within a box crossing the antimeridian, got %v", cells)
+	}
+	//The root spans both halves of the box, yet is returned once with all the locations within the box
+	if cells := q.Aggregate(*NewPosition(-20, 178), *NewPosition(-15, -179), 0, ""); len(cells) != 1 || cells[0].Count != 2 {
+		t.Fatalf("Expected the root cell with 2 locations, got %v", cells)
+	}
+}
+
+func TestQuadTree_AdaptiveSplitting(t *testing.T) {
+	maxLeaves := 4
+	q := NewQuadTree(16, WithMaxLeavesPerNode(maxLeaves))
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		q.Insert(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*0.01+12.97, rnd.Float64()*0.01+77.59), map[string]interface{}{}, 0)
+	}
+	q.Insert("ocean", *NewPosition(-40, -120), map[string]interface{}{}, 0)
+
+	var check func(node *QuadTreeNode) int
+	check = func(node *QuadTreeNode) int {
+		if node.children == nil {
+			if len(*node.leaves) > maxLeaves && node.depth < 16 {
+				t.Fatalf("Expected at most %d leaves in an unsplit node at depth %d, got %d", maxLeaves, node.depth, len(*node.leaves))
+			}
+			for locationID := range *node.leaves {
+				if q.locationIndex.Get(locationID) != node {
+					t.Fatalf("Expected %s to be indexed to the node holding it", locationID)
+				}
+			}
+			return node.depth
+		}
+		deepest := 0
+		for _, child := range node.children {
+			if depth := check(child); depth > deepest {
+				deepest = depth
+			}
+		}
+		return deepest
+	}
+	deepest := check(q.root)
+	if deepest < 8 {
+		t.Fatalf("Expected the dense area to be split deeply, got a depth of %d", deepest)
+	}
+	if stats := q.Stats(); stats.Locations != 201 || stats.Depth != deepest || stats.Nodes%4 != 1 {
+		t.Fatalf("Expected 201 locations in 4n+1 nodes down to depth %d, got %+v", deepest, stats)
+	}
+	if node := q.locationIndex.Get("ocean"); node.depth > 2 {
+		t.Fatalf("Expected ocean in a sparse area to be held near the root, got depth %d", node.depth)
+	}
+	if neighbors := q.GetNearbyLocations(*NewPosition(12.975, 77.595), 5000, 1000, nil, 0); len(neighbors) != 200 {
+		t.Fatalf("Expected 200 neighbors, got %d", len(neighbors))
+	}
+
+	for i := 0; i < 100; i++ {
+		q.UpdateLocation(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*0.01+52.5, rnd.Float64()*0.01+13.4), 0)
+	}
+	check(q.root)
+	for i := 0; i < 200; i++ {
+		q.Delete(fmt.Sprintf("loc%05d", i))
+	}
+	q.Delete("ocean")
+	if stats := q.Stats(); stats.Nodes != 1 || stats.Locations != 0 || stats.Depth != 0 {
+		t.Fatalf("Expected the emptied tree to be merged back into its root, got %+v", stats)
+	}
+}
+
+func TestQuadTree_ReinsertAcrossSplit(t *testing.T) {
+	q := NewQuadTree(16, WithMaxLeavesPerNode(2))
+	q.Insert("a", *NewPosition(10, 10), map[string]interface{}{}, 0)
+	q.Insert("x", *NewPosition(10.001, 10), map[string]interface{}{}, 0)
+	q.Insert("y", *NewPosition(10, 10.001), map[string]interface{}{}, 0)
+	q.Insert("a", *NewPosition(-30, -100), map[string]interface{}{}, 0)
+	q.Insert("c", *NewPosition(10.002, 10), map[string]interface{}{}, 0)
+	q.Insert("d", *NewPosition(10, 10.002), map[string]interface{}{}, 0)
+
+	if leaf, err := q.Get("a"); err != nil || leaf.Location != *NewPosition(-30, -100) {
+		t.Fatalf("Expected a at its reinserted position, got %v, %v", leaf.Location, err)
+	}
+	if stats := q.Stats(); stats.Locations != 5 {
+		t.Fatalf("Expected 5 locations, got %d", stats.Locations)
+	}
+	if err := q.Delete("a"); err != nil {
+		t.Fatalf("Expected a to be deleted, got %v", err)
+	}
+	for _, location := range []Position{*NewPosition(10, 10), *NewPosition(-30, -100)} {
+		if neighbors := q.GetNearbyLocations(location, 1000, 10, nil, 0); len(neighbors) > 0 && neighbors[0].Leaf.LocationID == "a" {
+			t.Fatalf("Expected a to be gone from %v, got %v", location, neighbors)
+		}
+	}
+	if stats := q.Stats(); stats.Locations != 4 {
+		t.Fatalf("Expected 4 locations after deleting a, got %d", stats.Locations)
+	}
+}
+
+func TestQuadTree_ConcurrentSplitting(t *testing.T) {
+	q := NewQuadTree(16, WithMaxLeavesPerNode(2))
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < 200; i++ {
+				locationID := fmt.Sprintf("w%d-%d", w, i%20)
+				position := *NewPosition(rnd.Float64()*0.1+12.9, rnd.Float64()*0.1+77.5)
+				switch i % 4 {
+				case 0:
+					q.Insert(locationID, position, map[string]interface{}{}, 0)
+				case 1:
+					q.UpdateLocation(locationID, position, 0)
+				case 2:
+					q.GetNearbyLocations(position, 2000, 10, nil, 0)
+					q.GetNearestLocations(position, 3, 0)
+				case 3:
+					q.Delete(locationID)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	for locationID, leaf := range q.GetAllLocations() {
+		if neighbors := q.GetNearbyLocations(leaf.GetLocation(), 1, 100, nil, 0); len(neighbors) == 0 {
+			t.Fatalf("Expected %s to be found at its own position", locationID)
+		}
+	}
+}
+
+func TestQuadTree_DistanceModels(t *testing.T) {
+	if _, err := ParseDistanceModel("manhattan"); err != errors.ErrInvalidDistanceModel {
+		t.Fatalf("Expected %v, got %v", errors.ErrInvalidDistanceModel, err)
+	}
+	radii := map[DistanceModel]int{Haversine: 500000, Vincenty: 500000, Planar: 20}
+	for _, name := range []string{"haversine", "vincenty", "planar"} {
+		model, _ := ParseDistanceModel(name)
+		q := NewQuadTree(16, WithDistanceModel(model), WithMaxLeavesPerNode(4))
+		rnd := rand.New(rand.NewSource(1))
+		for i := 0; i < 300; i++ {
+			q.Insert(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*40-20, rnd.Float64()*40-20), map[string]interface{}{}, 0)
+		}
+		allLocations := q.GetAllLocations()
+		for i := 0; i < 50; i++ {
+			location, radius := *NewPosition(rnd.Float64()*40-20, rnd.Float64()*40-20), rnd.Intn(radii[model])+1
+			distances := []float64{}
+			for _, leaf := range allLocations {
+				if distance := model.Distance(location, leaf.GetLocation()); distance <= float64(radius) {
+					distances = append(distances, distance)
+				}
+			}
+			sort.Float64s(distances)
+			neighbors := q.GetNearbyLocations(location, radius, len(allLocations), nil, 0)
+			if len(neighbors) != len(distances) {
+				t.Fatalf("%s: Expected %d locations within %d of %v, got %d", name, len(distances), radius, location, len(neighbors))
+			}
+			for j, neighbor := range neighbors {
+				if neighbor.Distance != distances[j] {
+					t.Fatalf("%s: Expected neighbor %d at %f, got %f", name, j, distances[j], neighbor.Distance)
+				}
+			}
+			if nearest := q.GetNearestLocations(location, 1, radius); len(distances) > 0 && nearest[0].Distance != distances[0] {
+				t.Fatalf("%s: Expected the nearest location at %f, got %v", name, distances[0], nearest)
+			}
+		}
+	}
+}
+
+func TestQuadTree_PlanarBounds(t *testing.T) {
+	q := NewQuadTree(16, WithPlanarBounds(0, 0, 10000, 5000), WithMaxLeavesPerNode(4))
+	if q.DistanceModel() != Planar {
+		t.Fatalf("Expected planar bounds to measure planar distances")
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		q.Insert(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*5000, rnd.Float64()*10000), map[string]interface{}{}, 0)
+	}
+	q.Insert("outside", *NewPosition(2500, 10001), map[string]interface{}{}, 0)
+	if _, err := q.Get("outside"); err == nil {
+		t.Fatalf("Expected a location outside the bounds to be ignored")
+	}
+	if stats := q.Stats(); stats.Locations != 300 || !stats.Planar || stats.Bounds != [4]float64{0, 0, 5000, 10000} {
+		t.Fatalf("Unexpected stats %+v", stats)
+	}
+	if err := q.UpdateLocation("loc00000", *NewPosition(-1, 5000), 0); err != errors.ErrPositionOutOfBounds {
+		t.Fatalf("Expected %v, got %v", errors.ErrPositionOutOfBounds, err)
+	}
+
+	//Beyond 180 a longitude would wrap, whereas x must not
+	inBox := q.GetLocationsInBox(*NewPosition(1000, 6000), *NewPosition(4000, 9000), 300, 0)
+	for _, result := range inBox {
+		if location := result.Leaf.GetLocation(); location.Long() < 6000 || location.Long() > 9000 {
+			t.Fatalf("Expected %v to lie within the box", location)
+		}
+	}
+	if len(inBox) == 0 {
+		t.Fatalf("Expected locations within the box")
+	}
+
+	allLocations := q.GetAllLocations()
+	for _, location := range []Position{*NewPosition(2500, 5000), *NewPosition(-100, -100), *NewPosition(5100, 10100)} {
+		count := 0
+		for _, leaf := range allLocations {
+			if Planar.Distance(location, leaf.GetLocation()) <= 1000 {
+				count++
+			}
+		}
+		if neighbors := q.GetNearbyLocations(location, 1000, len(allLocations), nil, 0); len(neighbors) != count {
+			t.Fatalf("Expected %d locations within 1000 of %v, got %d", count, location, len(neighbors))
+		}
+	}
+	if _, err := q.GetLocationsInGeohash("tdr1", 10); err != errors.ErrGeohashOnPlanar {
+		t.Fatalf("Expected %v for a geohash query on planar coordinates, got %v", errors.ErrGeohashOnPlanar, err)
+	}
+}
+
+func TestQuadTree_DistanceMatrix(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("driver1", *NewPosition(12.97, 77.59), map[string]interface{}{}, 0)
+	q.Insert("driver2", *NewPosition(12.93, 77.62), map[string]interface{}{}, 0)
+	var destinations []MatrixPoint
+	if err := json.Unmarshal([]byte(`["driver2",{"lat":13.19,"lon":77.70}]`), &destinations); err != nil {
+		t.Fatalf("Expected destinations to parse, got %v", err)
+	}
+	origins := []MatrixPoint{{LocationID: "driver1"}, {Position: NewPosition(12.97, 77.59)}}
+	matrix, err := q.DistanceMatrix(origins, destinations)
+	if err != nil || len(matrix) != 2 || len(matrix[0]) != 2 {
+		t.Fatalf("Expected a 2x2 matrix, got %v, %v", matrix, err)
+	}
+	for i := range origins {
+		if matrix[i][0] != DistanceOnEarth(NewPosition(12.97, 77.59), NewPosition(12.93, 77.62)) || matrix[i][1] != DistanceOnEarth(NewPosition(12.97, 77.59), NewPosition(13.19, 77.70)) {
+			t.Fatalf("Unexpected distances from origin %d: %v", i, matrix[i])
+		}
+	}
+	if _, err := q.DistanceMatrix([]MatrixPoint{{LocationID: "driver3"}}, destinations); err != errors.ErrLocationNotFound {
+		t.Fatalf("Expected %v, got %v", errors.ErrLocationNotFound, err)
+	}
+	if _, err := q.DistanceMatrix(origins, nil); err != errors.ErrInvalidMatrix {
+		t.Fatalf("Expected %v, got %v", errors.ErrInvalidMatrix, err)
+	}
+	if err := json.Unmarshal([]byte(`[{"lat":13.19}]`), &destinations); err != errors.ErrInvalidMatrix {
+		t.Fatalf("Expected %v, got %v", errors.ErrInvalidMatrix, err)
+	}
+}
+
+func TestQuadTree_Shapes(t *testing.T) {
+	q := NewQuadTree(16)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		lat, lon, size := rnd.Float64()*40-20, rnd.Float64()*40-20, rnd.Float64()*2
+		if i%2 == 0 {
+			square := *NewPolygon([]Position{*NewPosition(lat, lon), *NewPosition(lat+size, lon), *NewPosition(lat+size, lon+size), *NewPosition(lat, lon+size)})
+			q.SetShape(*NewPolygonShape(fmt.Sprintf("zone%03d", i), []Polygon{square}, nil), 0)
+		} else {
+			q.SetShape(*NewLineShape(fmt.Sprintf("road%03d", i), []Position{*NewPosition(lat, lon), *NewPosition(lat+size, lon-size)}, nil), 0)
+		}
+	}
+	//Spans all four quadrants of the root, so it stays at the root
+	q.SetShape(*NewLineShape("equator", []Position{*NewPosition(-1, -30), *NewPosition(1, 30)}, nil), 0)
+	if err := q.SetShape(*NewLineShape("stub", []Position{*NewPosition(0, 0)}, nil), 0); err != errors.ErrInvalidShape {
+		t.Fatalf("Expected %v, got %v", errors.ErrInvalidShape, err)
+	}
+	shapes := q.GetAllShapes()
+	if len(shapes) != 201 {
+		t.Fatalf("Expected 201 shapes, got %d", len(shapes))
+	}
+	for i := 0; i < 50; i++ {
+		location, radius := *NewPosition(rnd.Float64()*40-20, rnd.Float64()*40-20), rnd.Intn(200000)
+		expected := 0
+		for _, shape := range shapes {
+			if shape.distanceTo(location, Haversine) <= float64(radius) {
+				expected++
+			}
+		}
+		if nearby := q.GetShapesNearby(location, radius, len(shapes)); len(nearby) != expected {
+			t.Fatalf("Expected %d shapes within %d of %v, got %d", expected, radius, location, len(nearby))
+		}
+	}
+	for i := 0; i < 200; i++ {
+		location := *NewPosition(rnd.Float64()*40-20, rnd.Float64()*40-20)
+		expected := []string{}
+		for _, shape := range shapes {
+			if !shape.IsLine() && shape.Polygons[0].Contains(location) {
+				expected = append(expected, shape.ID)
+			}
+		}
+		containing := q.GetShapesContaining(location)
+		if len(containing) != len(expected) {
+			t.Fatalf("Expected %v to contain %v, got %v", expected, location, containing)
+		}
+		for j, shape := range containing {
+			if shape.ID != expected[j] {
+				t.Fatalf("Expected %v to contain %v, got %v", expected, location, containing)
+			}
+		}
+	}
+	for _, shape := range shapes {
+		q.DeleteShape(shape.ID)
+	}
+	if !q.shapes.root.isEmpty() {
+		t.Fatalf("Expected the emptied shape index to release its nodes")
+	}
+	if err := q.DeleteShape("equator"); err != errors.ErrShapeNotFound {
+		t.Fatalf("Expected %v, got %v", errors.ErrShapeNotFound, err)
+	}
+}
+
+func TestQuadTree_Altitude(t *testing.T) {
+	q := NewQuadTree(16)
+	q.Insert("ground", *NewPosition(12, 77), map[string]interface{}{}, 0)
+	q.Insert("roof", *NewPositionWithAltitude(12, 77.0001, 40), map[string]interface{}{}, 0)
+	q.Insert("drone", *NewPositionWithAltitude(12.0001, 77, 120), map[string]interface{}{}, 0)
+
+	location := *NewPositionWithAltitude(12, 77, 100)
+	if neighbors := q.GetNearbyLocations(location, 50, 10, nil, 0); len(neighbors) != 3 {
+		t.Fatalf("Expected the altitude to be ignored by a 2D query, got %v", neighbors)
+	}
+	neighbors := q.GetNearbyLocationsWithAltitude(location, 50, 10, nil, 0, AltitudeQuery{Use3D: true})
+	if len(neighbors) != 1 || neighbors[0].Leaf.LocationID != "drone" {
+		t.Fatalf("Expected only the drone within 50m in 3D, got %v", neighbors)
+	}
+	expected := math.Hypot(location.DistanceTo(*NewPosition(12.0001, 77), Haversine), 20)
+	if math.Abs(neighbors[0].Distance-expected) > 1e-6 {
+		t.Fatalf("Expected a 3D distance of %f, got %f", expected, neighbors[0].Distance)
+	}
+
+	minAlt, maxAlt := 10.0, 100.0
+	neighbors = q.GetNearbyLocationsWithAltitude(location, 50, 10, nil, 0, AltitudeQuery{MinAlt: &minAlt, MaxAlt: &maxAlt})
+	if len(neighbors) != 1 || neighbors[0].Leaf.LocationID != "roof" {
+		t.Fatalf("Expected only the roof within the altitude band, got %v", neighbors)
+	}
+	neighbors = q.GetNearbyLocationsWithAltitude(location, 50, 10, nil, 0, AltitudeQuery{MaxAlt: &minAlt})
+	if len(neighbors) != 1 || neighbors[0].Leaf.LocationID != "ground" {
+		t.Fatalf("Expected only the ground location below the band, got %v", neighbors)
+	}
+
+	//Positions written before altitudes were supported decode with an altitude of 0
+	var position Position
+	if err := json.Unmarshal([]byte(`{"Latitude":12,"Longitude":77}`), &position); err != nil || position.Alt() != 0 {
+		t.Fatalf("Expected a position without an altitude to decode, got %v, %v", position, err)
+	}
+}
+
+func TestQuadTree_CountQueries(t *testing.T) {
+	q := NewQuadTree(16, WithMaxLeavesPerNode(8))
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		status := "busy"
+		if i%3 == 0 {
+			status = "free"
+		}
+		q.Insert(fmt.Sprintf("loc%05d", i), *NewPosition(rnd.Float64()*2+12, rnd.Float64()*2+77), map[string]interface{}{"status": status}, int64(i))
+	}
+	filter, _ := ParseFilter(`{"status":"free"}`)
+	location := *NewPosition(13, 78)
+	for _, radius := range []int{1000, 30000, 100000, 400000} {
+		expected := len(q.GetNearbyLocations(location, radius, math.MaxInt32, filter, 100))
+		if count := q.CountNearbyLocations(location, radius, filter, 100, AltitudeQuery{}, 0); count != expected {
+			t.Fatalf("Expected %d locations within %dm, counted %d", expected, radius, count)
+		}
+	}
+
+	sw, ne := *NewPosition(12.5, 77.5), *NewPosition(13.5, 78.5)
+	if expected, count := len(q.GetLocationsInBox(sw, ne, math.MaxInt32, 250)), q.CountLocationsInBox(sw, ne, 250, 0); count != expected {
+		t.Fatalf("Expected %d locations within the box, counted %d", expected, count)
+	}
+
+	polygons := []Polygon{*NewPolygon([]Position{*NewPosition(12, 77), *NewPosition(14, 77), *NewPosition(12, 79), *NewPosition(12, 77)})}
+	if expected, count := len(q.GetLocationsInPolygon(polygons, math.MaxInt32)), q.CountLocationsInPolygon(polygons, 0); count != expected {
+		t.Fatalf("Expected %d locations within the polygon, counted %d", expected, count)
+	}
+
+	//A limit stops the count once reached, so that a limit of 1 tells whether there is any match
+	if count := q.CountLocationsInPolygon(polygons, 1); count != 1 {
+		t.Fatalf("Expected the count to stop at 1, got %d", count)
+	}
+	if count := q.CountNearbyLocations(*NewPosition(-40, -70), 1000, nil, 0, AltitudeQuery{}, 1); count != 0 {
+		t.Fatalf("Expected no locations far from the others, counted %d", count)
+	}
+}
@@ -0,0 +1,233 @@
+package ds
+
+import (
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"math"
+	"sort"
+)
+
+//Shape is a stored geometry, either polygons such as a service area or a line such as a road segment
+type Shape struct {
+	ID        string                 `json:"id"`
+	Polygons  []Polygon              `json:"polygons,omitempty"`
+	Line      []Position             `json:"line,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	UpdatedAt int64                  `json:"updated_at,omitempty"` //Unix time in milliseconds at which the shape was last written
+}
+
+func NewPolygonShape(id string, polygons []Polygon, data map[string]interface{}) *Shape {
+	return &Shape{ID: id, Polygons: polygons, Data: data}
+}
+
+func NewLineShape(id string, line []Position, data map[string]interface{}) *Shape {
+	return &Shape{ID: id, Line: line, Data: data}
+}
+
+//ParseGeoJSONShape parses a shape whose geometry is a GeoJSON Polygon, MultiPolygon or LineString, validating it
+func ParseGeoJSONShape(id string, geometry []byte, data map[string]interface{}) (Shape, error) {
+	if line, err := ParseGeoJSONLineString(geometry); err != quadrilleError.ErrUnsupportedGeoJSONType {
+		if err != nil {
+			return Shape{}, err
+		}
+		shape := *NewLineShape(id, line, data)
+		return shape, shape.Validate()
+	}
+	polygons, err := ParseGeoJSONPolygons(geometry)
+	if err == quadrilleError.ErrUnsupportedGeoJSONType {
+		err = quadrilleError.ErrInvalidShape
+	}
+	if err != nil {
+		return Shape{}, err
+	}
+	shape := *NewPolygonShape(id, polygons, data)
+	return shape, shape.Validate()
+}
+
+func (s Shape) IsLine() bool {
+	return len(s.Line) > 0
+}
+
+//Validate ensures the shape has an ID and exactly one valid geometry
+func (s Shape) Validate() error {
+	if s.ID == "" {
+		return quadrilleError.ErrMissingShapeID
+	}
+	if s.IsLine() {
+		if len(s.Polygons) > 0 || validateRoute(s.Line) != nil {
+			return quadrilleError.ErrInvalidShape
+		}
+		return nil
+	}
+	if len(s.Polygons) == 0 {
+		return quadrilleError.ErrInvalidShape
+	}
+	for _, polygon := range s.Polygons {
+		if !polygon.isValid() {
+			return quadrilleError.ErrInvalidPolygon
+		}
+	}
+	return nil
+}
+
+//Positions returns the positions of the line, or of the rings of the polygons
+func (s Shape) Positions() []Position {
+	if s.IsLine() {
+		return s.Line
+	}
+	positions := []Position{}
+	for _, polygon := range s.Polygons {
+		for _, ring := range polygon.rings() {
+			positions = append(positions, ring...)
+		}
+	}
+	return positions
+}
+
+//Returns the smallest rectangle containing the shape
+func (s Shape) boundingBox() Rectangle {
+	minLat, minLong, maxLat, maxLong := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, position := range s.Positions() {
+		minLat, maxLat = math.Min(minLat, position.Lat()), math.Max(maxLat, position.Lat())
+		minLong, maxLong = math.Min(minLong, position.Long()), math.Max(maxLong, position.Long())
+	}
+	return NewRectangle(NewPosition(minLat, minLong), NewPosition(maxLat, maxLong))
+}
+
+//Returns the segments of the line, or the edges of the rings of the polygons
+func (s Shape) segments() [][2]Position {
+	segments := [][2]Position{}
+	if s.IsLine() {
+		for i := 1; i < len(s.Line); i++ {
+			segments = append(segments, [2]Position{s.Line[i-1], s.Line[i]})
+		}
+		return segments
+	}
+	for _, polygon := range s.Polygons {
+		for _, ring := range polygon.rings() {
+			for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+				segments = append(segments, [2]Position{ring[j], ring[i]})
+			}
+		}
+	}
+	return segments
+}
+
+//Returns the distance from the location to the nearest point of the shape, 0 if it lies within one of its polygons
+func (s Shape) distanceTo(location GeoLocation, model DistanceModel) float64 {
+	for _, polygon := range s.Polygons {
+		if polygon.Contains(location) {
+			return 0
+		}
+	}
+	nearest := math.Inf(1)
+	for _, segment := range s.segments() {
+		distance, _ := distanceToSegment(location, segment[0], segment[1], model)
+		nearest = math.Min(nearest, distance)
+	}
+	return nearest
+}
+
+//ShapeResult is a shape matched by a query along with its distance from the queried location
+type ShapeResult struct {
+	Shape    Shape
+	Distance float64
+}
+
+type byShapeDistance []ShapeResult
+
+func (d byShapeDistance) Len() int {
+	return len(d)
+}
+
+func (d byShapeDistance) Swap(i, j int) {
+	d[i], d[j] = d[j], d[i]
+}
+
+func (d byShapeDistance) Less(i, j int) bool {
+	if d[i].Distance != d[j].Distance {
+		return d[i].Distance < d[j].Distance
+	}
+	return d[i].Shape.ID < d[j].Shape.ID
+}
+
+func sortAndLimitShapes(results []ShapeResult, limit int) []ShapeResult {
+	sort.Sort(byShapeDistance(results))
+	if len(results) > limit {
+		return results[:limit]
+	}
+	return results
+}
+
+//SetShape adds the shape to the tree, replacing any shape with the same ID
+func (q *QuadTree) SetShape(shape Shape, updatedAt int64) error {
+	if err := shape.Validate(); err != nil {
+		return err
+	}
+	for _, position := range shape.Positions() {
+		if !q.Contains(position) {
+			return quadrilleError.ErrPositionOutOfBounds
+		}
+	}
+	shape.UpdatedAt = updatedAt
+	q.shapes.set(&shape)
+	return nil
+}
+
+func (q *QuadTree) DeleteShape(id string) error {
+	if !q.shapes.delete(id) {
+		return quadrilleError.ErrShapeNotFound
+	}
+	return nil
+}
+
+func (q *QuadTree) GetShape(id string) (Shape, error) {
+	shape, ok := q.shapes.get(id)
+	if !ok {
+		return Shape{}, quadrilleError.ErrShapeNotFound
+	}
+	return shape, nil
+}
+
+//GetAllShapes returns every shape, ordered by ID
+func (q *QuadTree) GetAllShapes() []Shape {
+	return q.shapes.list()
+}
+
+//GetShapesContaining returns the shapes whose polygons contain the location, ordered by ID. Only the nodes of the
+//shape index along the path down to the location are visited, as a shape containing it lies within all of their boxes.
+func (q *QuadTree) GetShapesContaining(location Position) []Shape {
+	shapes := []Shape{}
+	q.shapes.visit(
+		func(box Rectangle) bool {
+			return isWithinBox(box, location)
+		},
+		func(shape *Shape) {
+			for _, polygon := range shape.Polygons {
+				if polygon.Contains(location) {
+					shapes = append(shapes, *shape)
+					return
+				}
+			}
+		})
+	sort.Slice(shapes, func(i, j int) bool {
+		return shapes[i].ID < shapes[j].ID
+	})
+	return shapes
+}
+
+//GetShapesNearby returns the shapes having a point within radiusInMetres of the location, those whose polygons contain
+//the location being at a distance of 0. Results are sorted by distance.
+func (q *QuadTree) GetShapesNearby(location Position, radiusInMetres, limit int) []ShapeResult {
+	radius := float64(radiusInMetres)
+	results := []ShapeResult{}
+	q.shapes.visit(
+		func(box Rectangle) bool {
+			return q.distance.MinDistanceToRectangle(location, box) <= radius
+		},
+		func(shape *Shape) {
+			if distance := shape.distanceTo(location, q.distance); distance <= radius {
+				results = append(results, ShapeResult{Shape: *shape, Distance: distance})
+			}
+		})
+	return sortAndLimitShapes(results, limit)
+}
@@ -0,0 +1,155 @@
+package ds
+
+import (
+	"sort"
+	"sync"
+)
+
+//Depth of the deepest node of the shape index
+const maxShapeDepth = 16
+
+//Holds the shapes in a region quadtree where each shape is kept in the deepest node whose box contains its bounding box,
+//so a shape spanning several quadrants stays in the node they share. Quadrants are only created once a shape descends into them.
+type shapeIndex struct {
+	root  *shapeNode
+	nodes map[string]*shapeNode //Node holding each shape by its ID
+	mtx   sync.RWMutex
+}
+
+type shapeNode struct {
+	boundingBox Rectangle
+	depth       int
+	children    [4]*shapeNode
+	shapes      map[string]*indexedShape
+	parent      *shapeNode
+}
+
+type indexedShape struct {
+	shape       *Shape
+	boundingBox Rectangle
+}
+
+func newShapeIndex(boundingBox Rectangle) *shapeIndex {
+	return &shapeIndex{
+		root:  &shapeNode{boundingBox: boundingBox, shapes: map[string]*indexedShape{}},
+		nodes: map[string]*shapeNode{},
+	}
+}
+
+func (s *shapeIndex) set(shape *Shape) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.remove(shape.ID)
+	entry := &indexedShape{shape: shape, boundingBox: shape.boundingBox()}
+	node := s.root
+	for node.depth < maxShapeDepth {
+		quadrant := node.containingQuadrant(entry.boundingBox)
+		if quadrant < 0 {
+			break
+		}
+		if node.children[quadrant] == nil {
+			node.children[quadrant] = &shapeNode{
+				boundingBox: node.boundingBox.GetQuadrants()[quadrant],
+				depth:       node.depth + 1,
+				shapes:      map[string]*indexedShape{},
+				parent:      node,
+			}
+		}
+		node = node.children[quadrant]
+	}
+	node.shapes[shape.ID] = entry
+	s.nodes[shape.ID] = node
+}
+
+//Returns the index of the quadrant of the node containing the box, or -1 if the box spans several of them
+func (n *shapeNode) containingQuadrant(box Rectangle) int {
+	for i, quadrant := range n.boundingBox.GetQuadrants() {
+		if isWithinBox(quadrant, box.Corner1()) && isWithinBox(quadrant, box.Corner2()) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *shapeIndex) delete(id string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.remove(id)
+}
+
+//Removes the shape, releasing the nodes left empty. The caller must hold the write lock.
+func (s *shapeIndex) remove(id string) bool {
+	node, ok := s.nodes[id]
+	if !ok {
+		return false
+	}
+	delete(node.shapes, id)
+	delete(s.nodes, id)
+	for node.parent != nil && node.isEmpty() {
+		for i, child := range node.parent.children {
+			if child == node {
+				node.parent.children[i] = nil
+			}
+		}
+		node = node.parent
+	}
+	return true
+}
+
+func (n *shapeNode) isEmpty() bool {
+	if len(n.shapes) > 0 {
+		return false
+	}
+	for _, child := range n.children {
+		if child != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *shapeIndex) get(id string) (Shape, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	node, ok := s.nodes[id]
+	if !ok {
+		return Shape{}, false
+	}
+	return *node.shapes[id].shape, true
+}
+
+func (s *shapeIndex) list() []Shape {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	shapes := make([]Shape, 0, len(s.nodes))
+	for id, node := range s.nodes {
+		shapes = append(shapes, *node.shapes[id].shape)
+	}
+	sort.Slice(shapes, func(i, j int) bool {
+		return shapes[i].ID < shapes[j].ID
+	})
+	return shapes
+}
+
+//Calls visit with each shape whose bounding box satisfies intersects, walking only the nodes whose box satisfies it
+func (s *shapeIndex) visit(intersects func(box Rectangle) bool, visit func(shape *Shape)) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	var walk func(node *shapeNode)
+	walk = func(node *shapeNode) {
+		if !intersects(node.boundingBox) {
+			return
+		}
+		for _, entry := range node.shapes {
+			if intersects(entry.boundingBox) {
+				visit(entry.shape)
+			}
+		}
+		for _, child := range node.children {
+			if child != nil {
+				walk(child)
+			}
+		}
+	}
+	walk(s.root)
+}
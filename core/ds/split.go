@@ -0,0 +1,130 @@
+package ds
+
+//TreeStats describes the shape of a QuadTree
+type TreeStats struct {
+	Nodes     int        `json:"nodes"`     //Number of allocated nodes, including the root
+	Locations int        `json:"locations"` //Number of locations held
+	Depth     int        `json:"depth"`     //Depth of the deepest node, the root being at depth 0
+	Planar    bool       `json:"planar"`    //Whether positions are y,x coordinates rather than latitudes and longitudes
+	Bounds    [4]float64 `json:"bounds"`    //Bounds of the positions as minLat,minLon,maxLat,maxLon, or minY,minX,maxY,maxX when planar
+}
+
+//Stats walks the tree to count its nodes and locations
+func (q *QuadTree) Stats() TreeStats {
+	q.structureMtx.RLock()
+	defer q.structureMtx.RUnlock()
+	stats := TreeStats{Planar: q.planar}
+	stats.Bounds[0], stats.Bounds[1], stats.Bounds[2], stats.Bounds[3] = getBoxBounds(q.root.boundingBox)
+	var walk func(node *QuadTreeNode)
+	walk = func(node *QuadTreeNode) {
+		stats.Nodes++
+		if node.depth > stats.Depth {
+			stats.Depth = node.depth
+		}
+		if node.leaves != nil {
+			node.leavesMtx.RLock()
+			stats.Locations += len(*node.leaves)
+			node.leavesMtx.RUnlock()
+			return
+		}
+		for _, child := range node.children {
+			walk(child)
+		}
+	}
+	walk(q.root)
+	return stats
+}
+
+//Removes the leaf from the node. A map keeps its buckets as entries are deleted, so an emptied map is replaced
+//to release the memory held for a node which was once crowded. The caller must hold the lock of the leaves.
+func removeLeaf(node *QuadTreeNode, locationID string) {
+	delete(*node.leaves, locationID)
+	if len(*node.leaves) == 0 {
+		*node.leaves = map[string]*QuadTreeLeaf{}
+	}
+}
+
+//Reports whether the node holds more leaves than allowed and may still be split.
+//The caller must hold a lock of the structure.
+func (q *QuadTree) isFull(node *QuadTreeNode) bool {
+	if node.leaves == nil || node.depth >= q.height {
+		return false
+	}
+	node.leavesMtx.RLock()
+	defer node.leavesMtx.RUnlock()
+	return len(*node.leaves) > q.maxLeaves
+}
+
+//Reports whether the node is split into quadrants which are not split themselves and have emptied out to at most
+//half the leaves a node holds before it is split. The margin keeps a node from being split and merged back repeatedly
+//as locations move across its edges. The caller must hold a lock of the structure.
+func (q *QuadTree) isSparse(node *QuadTreeNode) bool {
+	if node == nil || node.children == nil {
+		return false
+	}
+	count := 0
+	for _, child := range node.children {
+		if child.leaves == nil {
+			return false
+		}
+		child.leavesMtx.RLock()
+		count += len(*child.leaves)
+		child.leavesMtx.RUnlock()
+	}
+	return count <= q.maxLeaves/2
+}
+
+//Splits the node into quadrants if it is still full, moving its leaves into them
+func (q *QuadTree) split(node *QuadTreeNode) {
+	q.structureMtx.Lock()
+	defer q.structureMtx.Unlock()
+	q.splitFull(node)
+}
+
+//Splits the node if it is full, repeating for the quadrants which are full in turn.
+//The caller must hold the write lock of the structure.
+func (q *QuadTree) splitFull(node *QuadTreeNode) {
+	if !q.isFull(node) {
+		return
+	}
+	var children [4]*QuadTreeNode
+	quadrants := node.boundingBox.GetQuadrants()
+	for i := 0; i < 4; i++ {
+		children[i] = NewQuadTreeNode(quadrants[i], nil, false, &map[string]*QuadTreeLeaf{}, node)
+	}
+	node.children = &children
+	for locationID, leaf := range *node.leaves {
+		//A leaf indexed elsewhere has been replaced, so it is dropped rather than indexed again
+		if q.locationIndex.GetUnsafe(locationID) != node {
+			continue
+		}
+		child := node.findContainingChild(leaf.GetLocation())
+		(*child.leaves)[locationID] = leaf
+		q.locationIndex.SetUnsafe(locationID, child)
+	}
+	node.leaves = nil
+	for _, child := range children {
+		q.splitFull(child)
+	}
+}
+
+//Merges the quadrants of the node back into it while it is sparse, repeating for its ancestors
+func (q *QuadTree) merge(node *QuadTreeNode) {
+	q.structureMtx.Lock()
+	defer q.structureMtx.Unlock()
+	for ; q.isSparse(node); node = node.parent {
+		leaves := map[string]*QuadTreeLeaf{}
+		for _, child := range node.children {
+			for locationID, leaf := range *child.leaves {
+				if q.locationIndex.GetUnsafe(locationID) != child {
+					continue
+				}
+				leaves[locationID] = leaf
+				q.locationIndex.SetUnsafe(locationID, node)
+			}
+			child.leaves = nil
+		}
+		node.leaves = &leaves
+		node.children = nil
+	}
+}
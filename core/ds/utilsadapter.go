@@ -9,3 +9,19 @@ func EuclideanDistance(location1, location2 GeoLocation) float64 {
 func DistanceOnEarth(location1, location2 GeoLocation) float64 {
 	return utils.DistanceOnEarth(location1.Lat(), location1.Long(), location2.Lat(), location2.Long())
 }
+
+func Geohash(location GeoLocation, precision int) string {
+	return utils.GeohashEncode(location.Lat(), location.Long(), precision)
+}
+
+func GeohashBounds(geohash string) (Rectangle, error) {
+	minLat, minLong, maxLat, maxLong, err := utils.GeohashBounds(geohash)
+	if err != nil {
+		return nil, err
+	}
+	return NewRectangle(NewPosition(minLat, minLong), NewPosition(maxLat, maxLong)), nil
+}
+
+func VincentyDistance(location1, location2 GeoLocation) float64 {
+	return utils.VincentyDistance(location1.Lat(), location1.Long(), location2.Lat(), location2.Long())
+}
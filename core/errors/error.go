@@ -6,4 +6,24 @@ var (
 	ErrNonExistingLocationDeleteAttempt = errors.New("attempting to delete a non-existing location")
 	ErrNonExistingLocationUpdateAttempt = errors.New("attempting to update a non-existing location")
 	ErrLocationNotFound                 = errors.New("location not found")
+	ErrInvalidGeoJSON                   = errors.New("invalid GeoJSON")
+	ErrUnsupportedGeoJSONType           = errors.New("GeoJSON geometry must be a Polygon or MultiPolygon")
+	ErrInvalidPolygon                   = errors.New("polygon rings must have at least 3 valid positions")
+	ErrInvalidFilter                    = errors.New("filter must be a JSON object of data keys and conditions")
+	ErrUnsupportedFilterOperator        = errors.New("filter operator must be one of $eq, $ne, $gt, $gte, $lt, $lte, $in, $exists")
+	ErrMissingGeofenceID                = errors.New("geofence needs an id")
+	ErrInvalidGeofence                  = errors.New("geofence must either be a circle with a positive radius or a set of polygons")
+	ErrGeofenceNotFound                 = errors.New("geofence not found")
+	ErrInvalidHistorySize               = errors.New("history size must be between 0 and 10000")
+	ErrInvalidRoute                     = errors.New("route must be a GeoJSON LineString or an array of at least 2 valid lat, lon positions")
+	ErrInvalidGeohash                   = errors.New("geohash must be 1 to 12 characters of 0-9 and b-z excluding a, i, l and o")
+	ErrHistoryNotEnabled                = errors.New("history is not enabled for the location")
+	ErrPositionOutOfBounds              = errors.New("position must lie within the bounds of the world")
+	ErrGeohashOnPlanar                  = errors.New("geohashes are not defined for planar coordinates")
+	ErrInvalidDistanceModel             = errors.New("distance model must be one of haversine, vincenty, planar")
+	ErrMissingShapeID                   = errors.New("shape needs an id")
+	ErrInvalidShape                     = errors.New("shape must either be a GeoJSON Polygon or MultiPolygon, or a LineString of at least 2 valid positions")
+	ErrShapeNotFound                    = errors.New("shape not found")
+	ErrInvalidMatrix                    = errors.New("distance matrix needs origins and destinations of location ids or lat, lon positions, making at most 10000 pairs")
+	ErrInvalidProjection                = errors.New("fields must be a comma separated list of dot separated data keys")
 )
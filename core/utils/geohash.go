@@ -0,0 +1,93 @@
+package utils
+
+import (
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"strings"
+)
+
+//Alphabet of the base32 encoding used by geohashes
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+//Longest supported geohash, which is precise to a few centimetres
+const MaxGeohashPrecision = 12
+
+//GeohashEncode returns the geohash of the given precision, in characters, containing lat,long
+func GeohashEncode(lat, long float64, precision int) string {
+	if precision > MaxGeohashPrecision {
+		precision = MaxGeohashPrecision
+	}
+	minLat, maxLat, minLong, maxLong := -90.0, 90.0, -180.0, 180.0
+	var sb strings.Builder
+	bit, ch, isLong := 0, 0, true
+	for sb.Len() < precision {
+		//Bits alternate between longitude and latitude, starting with longitude
+		if isLong {
+			mid := (minLong + maxLong) / 2
+			if long >= mid {
+				ch = ch<<1 | 1
+				minLong = mid
+			} else {
+				ch = ch << 1
+				maxLong = mid
+			}
+		} else {
+			mid := (minLat + maxLat) / 2
+			if lat >= mid {
+				ch = ch<<1 | 1
+				minLat = mid
+			} else {
+				ch = ch << 1
+				maxLat = mid
+			}
+		}
+		isLong = !isLong
+		if bit++; bit == 5 {
+			sb.WriteByte(geohashBase32[ch])
+			bit, ch = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+//GeohashBounds returns the bounding box of the geohash
+func GeohashBounds(geohash string) (minLat, minLong, maxLat, maxLong float64, err error) {
+	if len(geohash) == 0 || len(geohash) > MaxGeohashPrecision {
+		return 0, 0, 0, 0, quadrilleError.ErrInvalidGeohash
+	}
+	minLat, maxLat, minLong, maxLong = -90.0, 90.0, -180.0, 180.0
+	isLong := true
+	for _, c := range strings.ToLower(geohash) {
+		val := strings.IndexRune(geohashBase32, c)
+		if val < 0 {
+			return 0, 0, 0, 0, quadrilleError.ErrInvalidGeohash
+		}
+		for mask := 16; mask > 0; mask >>= 1 {
+			if isLong {
+				mid := (minLong + maxLong) / 2
+				if val&mask != 0 {
+					minLong = mid
+				} else {
+					maxLong = mid
+				}
+			} else {
+				mid := (minLat + maxLat) / 2
+				if val&mask != 0 {
+					minLat = mid
+				} else {
+					maxLat = mid
+				}
+			}
+			isLong = !isLong
+		}
+	}
+	return minLat, minLong, maxLat, maxLong, nil
+}
+
+//GeohashDecode returns the center of the geohash
+func GeohashDecode(geohash string) (lat, long float64, err error) {
+	minLat, minLong, maxLat, maxLong, err := GeohashBounds(geohash)
+	if err != nil {
+		return 0, 0, err
+	}
+	return (minLat + maxLat) / 2, (minLong + maxLong) / 2, nil
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"math"
 	"testing"
 )
 
@@ -13,6 +15,18 @@ func TestDistanceOnEarth(t *testing.T) {
 	}
 }
 
+func TestVincentyDistance(t *testing.T) {
+	//Flinders Peak to Buninyong, the example in Vincenty's paper
+	expected := 54972.271
+	distance := VincentyDistance(-37.95103342, 144.42486789, -37.65282114, 143.92649554)
+	if math.Abs(distance-expected) > 0.001 {
+		t.Errorf("Expected %f, Got %f", expected, distance)
+	}
+	if distance := VincentyDistance(0, 0, 0.5, 179.7); distance <= 0 {
+		t.Errorf("Expected a positive distance between nearly antipodal points, Got %f", distance)
+	}
+}
+
 func TestEuclideanDistance(t *testing.T) {
 	expected := 0.036723691892838015
 	distance := EuclideanDistance(12.9660637, 77.7157481, 12.9958069, 77.6942081)
@@ -20,3 +34,18 @@ func TestEuclideanDistance(t *testing.T) {
 		t.Errorf("Expected %f, Got %f", expected, distance)
 	}
 }
+
+func TestGeohash(t *testing.T) {
+	expected := "u4pruydqqvj"
+	geohash := GeohashEncode(57.64911, 10.40744, 11)
+	if geohash != expected {
+		t.Errorf("Expected %s, Got %s", expected, geohash)
+	}
+	lat, long, err := GeohashDecode(geohash)
+	if err != nil || math.Abs(lat-57.64911) > 0.00001 || math.Abs(long-10.40744) > 0.00001 {
+		t.Errorf("Expected 57.64911,10.40744, Got %f,%f %v", lat, long, err)
+	}
+	if _, _, err := GeohashDecode("tdr1a"); err != quadrilleError.ErrInvalidGeohash {
+		t.Errorf("Expected %v, Got %v", quadrilleError.ErrInvalidGeohash, err)
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import "math"
+
+//WGS84 ellipsoid
+const (
+	wgs84SemiMajorAxis = 6378137.0
+	wgs84Flattening    = 1 / 298.257223563
+	wgs84SemiMinorAxis = wgs84SemiMajorAxis * (1 - wgs84Flattening)
+)
+
+//Iterations after which the inverse formula is considered not to converge
+const vincentyMaxIterations = 200
+
+//VincentyDistance returns the distance in metres between two points along the WGS84 ellipsoid using Vincenty's
+//inverse formula. For nearly antipodal points, where the formula does not converge, the spherical distance is returned.
+func VincentyDistance(lat1, long1, lat2, long2 float64) float64 {
+	a, b, f := wgs84SemiMajorAxis, wgs84SemiMinorAxis, wgs84Flattening
+	l := toRadians(long2 - long1)
+	sinU1, cosU1 := math.Sincos(math.Atan((1 - f) * math.Tan(toRadians(lat1))))
+	sinU2, cosU2 := math.Sincos(math.Atan((1 - f) * math.Tan(toRadians(lat2))))
+
+	lambda := l
+	for i := 0; i < vincentyMaxIterations; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		crossTerm := cosU1*sinU2 - sinU1*cosU2*cosLambda
+		sinSigma := math.Sqrt(cosU2*sinLambda*cosU2*sinLambda + crossTerm*crossTerm)
+		if sinSigma == 0 {
+			//Coincident points
+			return 0
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cosSqAlpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cosSqAlpha != 0 {
+			//Both points lie on the equator otherwise
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cosSqAlpha
+		}
+		c := f / 16 * cosSqAlpha * (4 + f*(4-3*cosSqAlpha))
+		prevLambda := lambda
+		lambda = l + (1-c)*f*sinAlpha*(sigma+c*sinSigma*(cos2SigmaM+c*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prevLambda) < 1e-12 {
+			uSq := cosSqAlpha * (a*a - b*b) / (b * b)
+			bigA := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+			bigB := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+			deltaSigma := bigB * sinSigma * (cos2SigmaM + bigB/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+				bigB/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+			return b * bigA * (sigma - deltaSigma)
+		}
+	}
+	return DistanceOnEarth(lat1, long1, lat2, long2)
+}
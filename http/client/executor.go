@@ -1,30 +1,82 @@
 package client
 
 import (
+	"github.com/quadrille/quadrille/core/ds"
 	"github.com/quadrille/quadrille/opt"
 	"strings"
 )
 
-func executeCmd(cmdParts []string, service opt.QuadrilleService) (respBody string, err error) {
+func executeCmd(cmdParts []string, fields ds.Projection, service opt.QuadrilleService) (respBody string, err error) {
 	switch opt.OperationType(cmdParts[0]) {
 	case opt.GetLocation:
-		return service.GetLocation(cmdParts[1])
+		return service.GetLocation(cmdParts[1], fields)
 	case opt.DeleteLocation:
 		return service.DeleteLocation(cmdParts[1])
 	case opt.Insert:
-		return service.Insert(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]), prepareDataFromStr(cmdParts, 3))
+		return service.Insert(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]), prepareDataFromStr(cmdParts, 3), prepareTTLFromStr(cmdParts, 4))
 	case opt.Update:
-		return service.Update(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]), prepareDataFromStr(cmdParts, 3))
+		return service.Update(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]), prepareDataFromStr(cmdParts, 3), prepareTTLFromStr(cmdParts, 4))
 	case opt.UpdateLocation:
-		return service.UpdateLocation(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]))
+		return service.UpdateLocation(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]), len(cmdParts) > 3 && cmdParts[3] == opt.RefreshTTL)
 	case opt.UpdateData:
 		return service.UpdateData(cmdParts[1], prepareDataFromStr(cmdParts, 2))
 	case opt.Neighbors:
-		return service.Neighbors(prepareNeighborQueryArgs(cmdParts))
+		location, radius, limit, filter, maxAge, altitude := prepareNeighborQueryArgs(cmdParts)
+		return service.Neighbors(location, radius, limit, filter, maxAge, altitude, fields)
+	case opt.Nearest:
+		location, k, maxDistance := prepareNearestQueryArgs(cmdParts)
+		return service.Nearest(location, k, maxDistance, fields)
+	case opt.Within:
+		sw, ne, limit, maxAge := prepareWithinQueryArgs(cmdParts)
+		return service.Within(sw, ne, limit, maxAge, fields)
+	case opt.Aggregate:
+		return service.Aggregate(prepareAggregateQueryArgs(cmdParts))
+	case opt.Cluster:
+		return service.Cluster(prepareClusterQueryArgs(cmdParts))
+	case opt.Geohash:
+		geohash, limit := prepareGeohashQueryArgs(cmdParts)
+		return service.Geohash(geohash, limit, fields)
+	case opt.Corridor:
+		route, buffer, limit, _ := opt.ParseCorridorArgs(cmdParts)
+		return service.Corridor(route, buffer, limit, fields)
+	case opt.Matrix:
+		origins, destinations, _ := opt.ParseMatrixArgs(cmdParts)
+		return service.DistanceMatrix(origins, destinations)
+	case opt.Polygon:
+		polygons, limit := preparePolygonQueryArgs(cmdParts)
+		return service.Polygon(polygons, limit, fields)
+	case opt.Count:
+		return executeCount(cmdParts[1:], service)
+	case opt.SetGeofence:
+		return service.SetGeofence(prepareGeofenceFromStr(cmdParts))
+	case opt.GetGeofence:
+		return service.GetGeofence(cmdParts[1])
+	case opt.DeleteGeofence:
+		return service.DeleteGeofence(cmdParts[1])
+	case opt.Geofences:
+		return service.Geofences()
+	case opt.SetShape:
+		return service.SetShape(prepareShapeFromStr(cmdParts))
+	case opt.GetShape:
+		return service.GetShape(cmdParts[1])
+	case opt.DeleteShape:
+		return service.DeleteShape(cmdParts[1])
+	case opt.NearbyShapes:
+		return service.NearbyShapes(prepareNearbyShapesQueryArgs(cmdParts))
+	case opt.Containing:
+		return service.Containing(*getGeolocationFromCoordsStr(cmdParts[1]), len(cmdParts) > 2 && cmdParts[2] == opt.WithData)
+	case opt.GeofenceEvents:
+		return service.GeofenceEvents(prepareGeofenceEventsQueryArgs(cmdParts))
+	case opt.SetHistory:
+		return service.SetHistory(prepareHistoryQueryArgs(cmdParts))
+	case opt.Trajectory:
+		return service.Trajectory(prepareTrajectoryQueryArgs(cmdParts))
 	case opt.Join:
 		return service.AddNode(cmdParts[1], cmdParts[2])
 	case opt.Remove:
 		return service.RemoveNode(cmdParts[1])
+	case opt.Stats:
+		return service.Stats()
 	case opt.Leader:
 		return service.Leader()
 	case opt.IsLeader:
@@ -39,12 +91,31 @@ func executeCmd(cmdParts []string, service opt.QuadrilleService) (respBody strin
 	return "", nil
 }
 
+//Executes the counted query, passing on its limit as the number of matches up to which to count
+func executeCount(query []string, service opt.QuadrilleService) (respBody string, err error) {
+	limit := opt.CountLimit(query)
+	switch query[0] {
+	case opt.Neighbors:
+		location, radius, _, filter, maxAge, altitude := prepareNeighborQueryArgs(query)
+		return service.CountNeighbors(location, radius, filter, maxAge, altitude, limit)
+	case opt.Within:
+		sw, ne, _, maxAge := prepareWithinQueryArgs(query)
+		return service.CountWithin(sw, ne, maxAge, limit)
+	default:
+		polygons, _ := preparePolygonQueryArgs(query)
+		return service.CountPolygon(polygons, limit)
+	}
+}
+
 func Executor(line string, service opt.QuadrilleService) (responseStr string, err error) {
-	cmdParts := strings.Split(line, " ")
+	cmdParts, fields, err := opt.SplitFields(strings.Split(line, " "))
+	if err != nil {
+		return "", err
+	}
 	validatorFunc := opt.NewValidator(cmdParts[0])
 	validationErr := validatorFunc(cmdParts)
 	if validationErr != nil {
 		return "", validationErr
 	}
-	return executeCmd(cmdParts, service)
+	return executeCmd(cmdParts, fields, service)
 }
@@ -10,7 +10,7 @@ import (
 type QuadrilleMockService struct {
 }
 
-func (q QuadrilleMockService) GetLocation(locationID string) (body string, err error) {
+func (q QuadrilleMockService) GetLocation(locationID string, fields ds.Projection) (body string, err error) {
 	b, err := json.Marshal(map[string]interface{}{
 		"lat":  12,
 		"long": 77,
@@ -25,15 +25,15 @@ func (q QuadrilleMockService) DeleteLocation(locationID string) (body string, er
 	return "", store.ErrNonExistentLocationDelete
 }
 
-func (q QuadrilleMockService) Insert(locationID string, location ds.Position, data map[string]interface{}) (body string, err error) {
+func (q QuadrilleMockService) Insert(locationID string, location ds.Position, data map[string]interface{}, ttl int) (body string, err error) {
 	return "", nil
 }
 
-func (q QuadrilleMockService) Update(locationID string, location ds.Position, data map[string]interface{}) (body string, err error) {
+func (q QuadrilleMockService) Update(locationID string, location ds.Position, data map[string]interface{}, ttl int) (body string, err error) {
 	return "", nil
 }
 
-func (q QuadrilleMockService) UpdateLocation(locationID string, location ds.Position) (body string, err error) {
+func (q QuadrilleMockService) UpdateLocation(locationID string, location ds.Position, refreshTTL bool) (body string, err error) {
 	return "", nil
 }
 
@@ -41,10 +41,106 @@ func (q QuadrilleMockService) UpdateData(locationID string, data map[string]inte
 	return "", nil
 }
 
-func (q QuadrilleMockService) Neighbors(location ds.Position, radius, limit int) (body string, err error) {
+func (q QuadrilleMockService) Neighbors(location ds.Position, radius, limit int, filter string, maxAge int, altitude ds.AltitudeQuery, fields ds.Projection) (body string, err error) {
 	panic("implement me")
 }
 
+func (q QuadrilleMockService) Nearest(location ds.Position, k, maxDistance int, fields ds.Projection) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) Within(sw, ne ds.Position, limit, maxAge int, fields ds.Projection) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) Polygon(polygons []ds.Polygon, limit int, fields ds.Projection) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) CountNeighbors(location ds.Position, radius int, filter string, maxAge int, altitude ds.AltitudeQuery, limit int) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) CountWithin(sw, ne ds.Position, maxAge, limit int) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) CountPolygon(polygons []ds.Polygon, limit int) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) SetGeofence(fence ds.Geofence) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) GetGeofence(id string) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) DeleteGeofence(id string) (body string, err error) {
+	return "", nil
+}
+
+func (q QuadrilleMockService) Geofences() (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) GeofenceEvents(since uint64, limit int) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) Aggregate(sw, ne ds.Position, depth int, field string) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) Cluster(sw, ne ds.Position, zoom, samples int) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) Geohash(geohash string, limit int, fields ds.Projection) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) Corridor(route []ds.Position, buffer, limit int, fields ds.Projection) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) DistanceMatrix(origins, destinations []ds.MatrixPoint) (body string, err error) {
+	return `{"distances":[[0]]}`, nil
+}
+
+func (q QuadrilleMockService) SetShape(shape ds.Shape) (body string, err error) {
+	return "ok", nil
+}
+
+func (q QuadrilleMockService) GetShape(id string) (body string, err error) {
+	return "{}", nil
+}
+
+func (q QuadrilleMockService) DeleteShape(id string) (body string, err error) {
+	return "ok", nil
+}
+
+func (q QuadrilleMockService) NearbyShapes(location ds.Position, radius, limit int) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) Containing(location ds.Position, withData bool) (body string, err error) {
+	return "[]", nil
+}
+
+func (q QuadrilleMockService) SetHistory(locationID string, size int) (body string, err error) {
+	return "ok", nil
+}
+
+func (q QuadrilleMockService) Trajectory(locationID string, from, to int64) (body string, err error) {
+	return "{}", nil
+}
+
+func (q QuadrilleMockService) Stats() (body string, err error) {
+	return `{"nodes":1,"locations":0,"depth":0}`, nil
+}
+
 func (q QuadrilleMockService) IsLeader() (body string, err error) {
 	return "true", nil
 }
@@ -76,6 +172,25 @@ func TestExecutor(t *testing.T) {
 	delLocationCmd := "del"
 	insertLocationCmd := "insert loc002"
 	neighborsCmd := "neighbors 12,77"
+	neighborsFilterCmd := `neighbors 12,77 100 5 {"status":{"$like":"free"}}`
+	neighborsAltitudeCmd := "neighbors 12,77,30 100 3d alt=50:10"
+	countCmd := "count nearest 12,77"
+	withinAltitudeCmd := "within 12,77,30 13,78"
+	getFieldsCmd := "get loc1 fields=name,,vehicle.plate"
+	countNeighborsCmd := "count neighbors 12,77"
+	withinCmd := "within 13,78 12,77"
+	withinMaxAgeCmd := "within 12,77 13,78 10 maxage=-1"
+	watchCmd := "watch within=12,179,13,-179"
+	aggregateCmd := "aggregate 12,77 13,78 deep"
+	geohashCmd := "geohash tdr1a"
+	corridorCmd := "corridor 12.97,77.70 500"
+	matrixCmd := "matrix driver1 12.97,77.59"
+	setShapeCmd := `setshape zone {"type":"Point","coordinates":[77,12]}`
+	containingCmd := "containing 12.97,77.59 geometry"
+	nearestCmd := "nearest 12,77 0"
+	setGeofenceCmd := "setgeofence airport 13.19,77.70"
+	setHistoryCmd := "sethistory loc001"
+	polygonCmd := `polygon {"type":"Point","coordinates":[77,12]}`
 	getLeaderCmd := "leader"
 	isLeader := "isleader"
 
@@ -103,6 +218,120 @@ func TestExecutor(t *testing.T) {
 		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
 	}
 
+	_, err = Executor(neighborsFilterCmd, quadrilleMockService)
+	expectedErrTxt = "filter operator must be one of $eq, $ne, $gt, $gte, $lt, $lte, $in, $exists"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(neighborsAltitudeCmd, quadrilleMockService)
+	expectedErrTxt = "alt should be given as alt=<min>:<max> with min not above max"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(getFieldsCmd, quadrilleMockService)
+	expectedErrTxt = "fields must be a comma separated list of dot separated data keys"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(withinAltitudeCmd, quadrilleMockService)
+	expectedErrTxt = "invalid lat,lon"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(countCmd, quadrilleMockService)
+	expectedErrTxt = "count needs a neighbors, within or polygon query"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(countNeighborsCmd, quadrilleMockService)
+	expectedErrTxt = "neighbors needs a radius"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(nearestCmd, quadrilleMockService)
+	expectedErrTxt = "k should be a positive integer"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(setGeofenceCmd, quadrilleMockService)
+	expectedErrTxt = "setgeofence needs a radius"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(setHistoryCmd, quadrilleMockService)
+	expectedErrTxt = "sethistory needs a location_id and the number of positions to retain"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(withinCmd, quadrilleMockService)
+	expectedErrTxt = "minLat must be less than or equal to maxLat"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(watchCmd, quadrilleMockService)
+	expectedErrTxt = store.ErrInvalidWatchRegion.Error()
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(withinMaxAgeCmd, quadrilleMockService)
+	expectedErrTxt = "maxage should be a non negative integer"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(aggregateCmd, quadrilleMockService)
+	expectedErrTxt = "depth should be a non negative integer"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(geohashCmd, quadrilleMockService)
+	expectedErrTxt = "geohash must be 1 to 12 characters of 0-9 and b-z excluding a, i, l and o"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(corridorCmd, quadrilleMockService)
+	expectedErrTxt = "corridor needs a route of at least 2 lat,lon positions or a GeoJSON LineString"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(matrixCmd, quadrilleMockService)
+	expectedErrTxt = "matrix needs origins and destinations separated by `to`, each a location_id or lat,lon"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(setShapeCmd, quadrilleMockService)
+	expectedErrTxt = "shape must either be a GeoJSON Polygon or MultiPolygon, or a LineString of at least 2 valid positions"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(containingCmd, quadrilleMockService)
+	expectedErrTxt = "containing only accepts `data` after the lat,lon"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
+	_, err = Executor(polygonCmd, quadrilleMockService)
+	expectedErrTxt = "GeoJSON geometry must be a Polygon or MultiPolygon"
+	if err == nil || err.Error() != expectedErrTxt {
+		t.Fatalf("Expected: %s, got: %s", expectedErrTxt, err)
+	}
+
 	responseStr, err = Executor(getLeaderCmd, quadrilleMockService)
 	expectedResp = ":5677"
 	if responseStr != expectedResp {
@@ -21,18 +21,37 @@ func New(quadrilleHTTPHost string) opt.QuadrilleService {
 	return &quadrilleHTTPClient{host: "http://" + quadrilleHTTPHost}
 }
 
-func (q quadrilleHTTPClient) GetLocation(locationID string) (body string, err error) {
-	body, _, err = Get(q.host + "/location/" + locationID).SetTimeout(5000).Do()
+func (q quadrilleHTTPClient) GetLocation(locationID string, fields ds.Projection) (body string, err error) {
+	body, _, err = Get(q.host + "/location/" + locationID).SetQueryParams(withFields(map[string]string{}, fields)).SetTimeout(5000).Do()
 	return
 }
 
+//Adds the data keys selected by the projection to the query params, if any were selected
+func withFields(queryParams map[string]string, fields ds.Projection) map[string]string {
+	if fields != nil {
+		queryParams["fields"] = fields.String()
+	}
+	return queryParams
+}
+
 func (q quadrilleHTTPClient) DeleteLocation(locationID string) (body string, err error) {
 	body, _, err = Delete(q.host + "/location/" + locationID).SetTimeout(5000).Do()
 	return
 }
 
-func (q quadrilleHTTPClient) Insert(locationID string, location ds.Position, data map[string]interface{}) (body string, err error) {
-	payload, err := json.Marshal(map[string]interface{}{"lat": location.Lat(), "lon": location.Long(), "data": data})
+//Returns the lat, lon and, when set, the alt of the location as written in a request body
+func getPositionPayload(location ds.Position) map[string]interface{} {
+	payload := map[string]interface{}{"lat": location.Lat(), "lon": location.Long()}
+	if location.Alt() != 0 {
+		payload["alt"] = location.Alt()
+	}
+	return payload
+}
+
+func (q quadrilleHTTPClient) Insert(locationID string, location ds.Position, data map[string]interface{}, ttl int) (body string, err error) {
+	payloadMap := getPositionPayload(location)
+	payloadMap["data"], payloadMap["ttl"] = data, ttl
+	payload, err := json.Marshal(payloadMap)
 	if err != nil {
 		return
 	}
@@ -40,8 +59,10 @@ func (q quadrilleHTTPClient) Insert(locationID string, location ds.Position, dat
 	return
 }
 
-func (q quadrilleHTTPClient) Update(locationID string, location ds.Position, data map[string]interface{}) (body string, err error) {
-	payload, err := json.Marshal(map[string]interface{}{"lat": location.Lat(), "lon": location.Long(), "data": data})
+func (q quadrilleHTTPClient) Update(locationID string, location ds.Position, data map[string]interface{}, ttl int) (body string, err error) {
+	payloadMap := getPositionPayload(location)
+	payloadMap["data"], payloadMap["ttl"] = data, ttl
+	payload, err := json.Marshal(payloadMap)
 	if err != nil {
 		return
 	}
@@ -49,8 +70,10 @@ func (q quadrilleHTTPClient) Update(locationID string, location ds.Position, dat
 	return
 }
 
-func (q quadrilleHTTPClient) UpdateLocation(locationID string, location ds.Position) (body string, err error) {
-	payload, err := json.Marshal(map[string]interface{}{"lat": location.Lat(), "lon": location.Long()})
+func (q quadrilleHTTPClient) UpdateLocation(locationID string, location ds.Position, refreshTTL bool) (body string, err error) {
+	payloadMap := getPositionPayload(location)
+	payloadMap["refresh_ttl"] = refreshTTL
+	payload, err := json.Marshal(payloadMap)
 	if err != nil {
 		return
 	}
@@ -71,32 +94,317 @@ func (q quadrilleHTTPClient) BulkWrite(commands []store.Command) (body string, e
 	return "", errors.New("operation not supported by client")
 }
 
-func (q quadrilleHTTPClient) Neighbors(location ds.Position, radius, limit int) (body string, err error) {
-	body, _, err = Get(q.host + "/neighbors").SetQueryParams(
+//Returns the query params of /neighbors and /neighbors/count
+func getNeighborQueryParams(location ds.Position, radius, limit int, filter string, maxAge int, altitude ds.AltitudeQuery) map[string]string {
+	queryParams := map[string]string{
+		"radius": strconv.Itoa(radius),
+		"limit":  strconv.Itoa(limit),
+		"lat":    fmt.Sprintf("%f", location.Lat()),
+		"lon":    fmt.Sprintf("%f", location.Long()),
+		"maxAge": strconv.Itoa(maxAge),
+	}
+	if filter != "" {
+		queryParams["filter"] = filter
+	}
+	if location.Alt() != 0 {
+		queryParams["alt"] = fmt.Sprintf("%f", location.Alt())
+	}
+	if altitude.Use3D {
+		queryParams["3d"] = "true"
+	}
+	if altitude.MinAlt != nil {
+		queryParams["minAlt"] = fmt.Sprintf("%f", *altitude.MinAlt)
+	}
+	if altitude.MaxAlt != nil {
+		queryParams["maxAlt"] = fmt.Sprintf("%f", *altitude.MaxAlt)
+	}
+	return queryParams
+}
+
+func (q quadrilleHTTPClient) Neighbors(location ds.Position, radius, limit int, filter string, maxAge int, altitude ds.AltitudeQuery, fields ds.Projection) (body string, err error) {
+	queryParams := getNeighborQueryParams(location, radius, limit, filter, maxAge, altitude)
+	body, _, err = Get(q.host + "/neighbors").SetQueryParams(withFields(queryParams, fields)).SetTimeout(5000).Do()
+	if err == nil {
+		body = formatNeighborResults(body)
+	}
+	if body == "" {
+		body = fmt.Sprintf("No match found within %dm of %f,%f", radius, location.Lat(), location.Long())
+	}
+	return
+}
+
+func (q quadrilleHTTPClient) Nearest(location ds.Position, k, maxDistance int, fields ds.Projection) (body string, err error) {
+	body, _, err = Get(q.host + "/nearest").SetQueryParams(withFields(
+		map[string]string{
+			"k":           strconv.Itoa(k),
+			"maxDistance": strconv.Itoa(maxDistance),
+			"lat":         fmt.Sprintf("%f", location.Lat()),
+			"lon":         fmt.Sprintf("%f", location.Long()),
+		}, fields)).SetTimeout(5000).Do()
+	if err == nil {
+		body = formatNeighborResults(body)
+	}
+	if body == "" {
+		body = fmt.Sprintf("No match found near %f,%f", location.Lat(), location.Long())
+	}
+	return
+}
+
+func (q quadrilleHTTPClient) Within(sw, ne ds.Position, limit, maxAge int, fields ds.Projection) (body string, err error) {
+	body, _, err = Get(q.host + "/within").SetQueryParams(withFields(
 		map[string]string{
-			"radius": strconv.Itoa(radius),
 			"limit":  strconv.Itoa(limit),
-			"lat":    fmt.Sprintf("%f", location.Lat()),
-			"lon":    fmt.Sprintf("%f", location.Long()),
-		}).SetTimeout(5000).Do()
+			"maxAge": strconv.Itoa(maxAge),
+			"minLat": fmt.Sprintf("%f", sw.Lat()),
+			"minLon": fmt.Sprintf("%f", sw.Long()),
+			"maxLat": fmt.Sprintf("%f", ne.Lat()),
+			"maxLon": fmt.Sprintf("%f", ne.Long()),
+		}, fields)).SetTimeout(5000).Do()
 	if err == nil {
-		var results []types.NeighborResult
-		parseErr := json.Unmarshal([]byte(body), &results)
-		var sb strings.Builder
-		if parseErr == nil {
-			for i, result := range results {
-				dataByte, _ := json.Marshal(result.Data)
-				sb.WriteString(fmt.Sprintf("%s %f,%f %.0fm %s", result.LocationID, result.Latitude, result.Longitude, math.Round(result.Distance), string(dataByte)))
-				if i != len(results)-1 {
-					sb.WriteString("\n")
-				}
-			}
-			body = sb.String()
+		body = formatNeighborResults(body)
+	}
+	if body == "" {
+		body = fmt.Sprintf("No match found within %f,%f and %f,%f", sw.Lat(), sw.Long(), ne.Lat(), ne.Long())
+	}
+	return
+}
+
+func (q quadrilleHTTPClient) Polygon(polygons []ds.Polygon, limit int, fields ds.Projection) (body string, err error) {
+	payload, err := ds.PolygonsToGeoJSON(polygons)
+	if err != nil {
+		return
+	}
+	body, _, err = Post(q.host + "/polygon").SetPayload(string(payload)).SetQueryParams(withFields(
+		map[string]string{
+			"limit": strconv.Itoa(limit),
+		}, fields)).SetContentType(JSON).SetTimeout(5000).Do()
+	if err == nil {
+		body = formatNeighborResults(body)
+	}
+	if body == "" {
+		body = "No match found within polygon"
+	}
+	return
+}
+
+func (q quadrilleHTTPClient) CountNeighbors(location ds.Position, radius int, filter string, maxAge int, altitude ds.AltitudeQuery, limit int) (body string, err error) {
+	queryParams := getNeighborQueryParams(location, radius, limit, filter, maxAge, altitude)
+	body, _, err = Get(q.host + "/neighbors/count").SetQueryParams(queryParams).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) CountWithin(sw, ne ds.Position, maxAge, limit int) (body string, err error) {
+	body, _, err = Get(q.host + "/within/count").SetQueryParams(
+		map[string]string{
+			"limit":  strconv.Itoa(limit),
+			"maxAge": strconv.Itoa(maxAge),
+			"minLat": fmt.Sprintf("%f", sw.Lat()),
+			"minLon": fmt.Sprintf("%f", sw.Long()),
+			"maxLat": fmt.Sprintf("%f", ne.Lat()),
+			"maxLon": fmt.Sprintf("%f", ne.Long()),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) CountPolygon(polygons []ds.Polygon, limit int) (body string, err error) {
+	payload, err := ds.PolygonsToGeoJSON(polygons)
+	if err != nil {
+		return
+	}
+	body, _, err = Post(q.host + "/polygon/count").SetPayload(string(payload)).SetQueryParams(
+		map[string]string{
+			"limit": strconv.Itoa(limit),
+		}).SetContentType(JSON).SetTimeout(5000).Do()
+	return
+}
+
+//Formats the JSON results of a location query into one line per location
+func formatNeighborResults(body string) string {
+	var results []types.NeighborResult
+	parseErr := json.Unmarshal([]byte(body), &results)
+	if parseErr != nil {
+		return body
+	}
+	var sb strings.Builder
+	for i, result := range results {
+		dataByte, _ := json.Marshal(result.Data)
+		sb.WriteString(fmt.Sprintf("%s %f,%f %.0fm %s", result.LocationID, result.Latitude, result.Longitude, math.Round(result.Distance), string(dataByte)))
+		if i != len(results)-1 {
+			sb.WriteString("\n")
 		}
 	}
+	return sb.String()
+}
+
+func (q quadrilleHTTPClient) Aggregate(sw, ne ds.Position, depth int, field string) (body string, err error) {
+	body, _, err = Get(q.host + "/aggregate").SetQueryParams(
+		map[string]string{
+			"depth":  strconv.Itoa(depth),
+			"field":  field,
+			"minLat": fmt.Sprintf("%f", sw.Lat()),
+			"minLon": fmt.Sprintf("%f", sw.Long()),
+			"maxLat": fmt.Sprintf("%f", ne.Lat()),
+			"maxLon": fmt.Sprintf("%f", ne.Long()),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) Cluster(sw, ne ds.Position, zoom, samples int) (body string, err error) {
+	body, _, err = Get(q.host + "/cluster").SetQueryParams(
+		map[string]string{
+			"zoom":    strconv.Itoa(zoom),
+			"samples": strconv.Itoa(samples),
+			"minLat":  fmt.Sprintf("%f", sw.Lat()),
+			"minLon":  fmt.Sprintf("%f", sw.Long()),
+			"maxLat":  fmt.Sprintf("%f", ne.Lat()),
+			"maxLon":  fmt.Sprintf("%f", ne.Long()),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) Geohash(geohash string, limit int, fields ds.Projection) (body string, err error) {
+	body, _, err = Get(q.host + "/geohash/" + geohash).SetQueryParams(withFields(
+		map[string]string{
+			"limit": strconv.Itoa(limit),
+		}, fields)).SetTimeout(5000).Do()
+	if err == nil {
+		body = formatNeighborResults(body)
+	}
 	if body == "" {
-		body = fmt.Sprintf("No match found within %dm of %f,%f", radius, location.Lat(), location.Long())
+		body = fmt.Sprintf("No match found within geohash %s", geohash)
+	}
+	return
+}
+
+func (q quadrilleHTTPClient) Corridor(route []ds.Position, buffer, limit int, fields ds.Projection) (body string, err error) {
+	positions := make([]map[string]float64, 0, len(route))
+	for _, position := range route {
+		positions = append(positions, map[string]float64{"lat": position.Lat(), "lon": position.Long()})
+	}
+	payload, err := json.Marshal(positions)
+	if err != nil {
+		return
+	}
+	body, _, err = Post(q.host + "/corridor").SetQueryParams(withFields(
+		map[string]string{
+			"buffer": strconv.Itoa(buffer),
+			"limit":  strconv.Itoa(limit),
+		}, fields)).SetPayload(string(payload)).SetTimeout(5000).Do()
+	if err == nil {
+		body = formatNeighborResults(body)
+	}
+	if body == "" {
+		body = fmt.Sprintf("No match found within %dm of the route", buffer)
+	}
+	return
+}
+
+func (q quadrilleHTTPClient) DistanceMatrix(origins, destinations []ds.MatrixPoint) (body string, err error) {
+	payload, err := json.Marshal(types.DistanceMatrix{Origins: origins, Destinations: destinations})
+	if err != nil {
+		return
+	}
+	body, _, err = Post(q.host + "/matrix").SetPayload(string(payload)).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) SetGeofence(fence ds.Geofence) (body string, err error) {
+	payload, err := json.Marshal(types.NewGeofence(fence))
+	if err != nil {
+		return
+	}
+	body, _, err = Put(q.host + "/geofence/" + fence.ID).SetPayload(string(payload)).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) GetGeofence(id string) (body string, err error) {
+	body, _, err = Get(q.host + "/geofence/" + id).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) DeleteGeofence(id string) (body string, err error) {
+	body, _, err = Delete(q.host + "/geofence/" + id).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) Geofences() (body string, err error) {
+	body, _, err = Get(q.host + "/geofences").SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) SetShape(shape ds.Shape) (body string, err error) {
+	payload, err := json.Marshal(types.NewShape(shape))
+	if err != nil {
+		return
+	}
+	body, _, err = Put(q.host + "/shape/" + shape.ID).SetPayload(string(payload)).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) GetShape(id string) (body string, err error) {
+	body, _, err = Get(q.host + "/shape/" + id).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) DeleteShape(id string) (body string, err error) {
+	body, _, err = Delete(q.host + "/shape/" + id).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) NearbyShapes(location ds.Position, radius, limit int) (body string, err error) {
+	body, _, err = Get(q.host + "/shapes/nearby").SetQueryParams(
+		map[string]string{
+			"lat":    strconv.FormatFloat(location.Lat(), 'f', -1, 64),
+			"lon":    strconv.FormatFloat(location.Long(), 'f', -1, 64),
+			"radius": strconv.Itoa(radius),
+			"limit":  strconv.Itoa(limit),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) Containing(location ds.Position, withData bool) (body string, err error) {
+	body, _, err = Get(q.host + "/containing").SetQueryParams(
+		map[string]string{
+			"lat":  strconv.FormatFloat(location.Lat(), 'f', -1, 64),
+			"lon":  strconv.FormatFloat(location.Long(), 'f', -1, 64),
+			"data": strconv.FormatBool(withData),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) GeofenceEvents(since uint64, limit int) (body string, err error) {
+	body, _, err = Get(q.host + "/geofences/events").SetQueryParams(
+		map[string]string{
+			"since": strconv.FormatUint(since, 10),
+			"limit": strconv.Itoa(limit),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) SetHistory(locationID string, size int) (body string, err error) {
+	if size == 0 {
+		body, _, err = Delete(q.host + "/history/" + locationID).SetTimeout(5000).Do()
+		return
+	}
+	payload, err := json.Marshal(map[string]interface{}{"size": size})
+	if err != nil {
+		return
 	}
+	body, _, err = Put(q.host + "/history/" + locationID).SetPayload(string(payload)).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) Trajectory(locationID string, from, to int64) (body string, err error) {
+	body, _, err = Get(q.host + "/history/" + locationID).SetQueryParams(
+		map[string]string{
+			"from": strconv.FormatInt(from, 10),
+			"to":   strconv.FormatInt(to, 10),
+		}).SetTimeout(5000).Do()
+	return
+}
+
+func (q quadrilleHTTPClient) Stats() (body string, err error) {
+	body, _, err = Get(q.host + "/stats").SetTimeout(5000).Do()
 	return
 }
 
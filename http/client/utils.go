@@ -3,6 +3,7 @@ package client
 import (
 	"encoding/json"
 	"github.com/quadrille/quadrille/core/ds"
+	"github.com/quadrille/quadrille/opt"
 	"github.com/quadrille/quadrille/replication/store"
 	"strconv"
 	"strings"
@@ -13,12 +14,51 @@ func getGeolocationFromCoordsStr(coords string) *ds.Position {
 	latStr, longStr := latLong[0], latLong[1]
 	lat, _ := strconv.ParseFloat(latStr, 64)
 	long, _ := strconv.ParseFloat(longStr, 64)
-	return ds.NewPosition(lat, long)
+	var alt float64
+	if len(latLong) > 2 {
+		alt, _ = strconv.ParseFloat(latLong[2], 64)
+	}
+	return ds.NewPositionWithAltitude(lat, long, alt)
 }
 
-func prepareNeighborQueryArgs(cmdParts []string) (location ds.Position, radius int, limit int) {
+func prepareNeighborQueryArgs(cmdParts []string) (location ds.Position, radius int, limit int, filter string, maxAge int, altitude ds.AltitudeQuery) {
+	cmdParts, maxAge, _ = opt.SplitMaxAge(cmdParts)
+	cmdParts, altitude, _ = opt.SplitAltitude(cmdParts)
 	location = *getGeolocationFromCoordsStr(cmdParts[1])
 	radius, _ = strconv.Atoi(cmdParts[2])
+	limit = 10
+	if len(cmdParts) > 3 {
+		limitTmp, err := strconv.Atoi(cmdParts[3])
+		if err == nil {
+			limit = limitTmp
+		} else {
+			filter = cmdParts[3]
+		}
+	}
+	if len(cmdParts) > 4 {
+		filter = cmdParts[4]
+	}
+	return
+}
+
+func prepareNearestQueryArgs(cmdParts []string) (location ds.Position, k int, maxDistance int) {
+	location = *getGeolocationFromCoordsStr(cmdParts[1])
+	k = 10
+	if len(cmdParts) > 2 {
+		if kTmp, err := strconv.Atoi(cmdParts[2]); err == nil {
+			k = kTmp
+		}
+	}
+	if len(cmdParts) > 3 {
+		maxDistance, _ = strconv.Atoi(cmdParts[3])
+	}
+	return
+}
+
+func prepareWithinQueryArgs(cmdParts []string) (sw, ne ds.Position, limit, maxAge int) {
+	cmdParts, maxAge, _ = opt.SplitMaxAge(cmdParts)
+	sw = *getGeolocationFromCoordsStr(cmdParts[1])
+	ne = *getGeolocationFromCoordsStr(cmdParts[2])
 	if len(cmdParts) > 3 {
 		limitTmp, err := strconv.Atoi(cmdParts[3])
 		if err == nil {
@@ -30,6 +70,106 @@ func prepareNeighborQueryArgs(cmdParts []string) (location ds.Position, radius i
 	return
 }
 
+func prepareAggregateQueryArgs(cmdParts []string) (sw, ne ds.Position, depth int, field string) {
+	sw = *getGeolocationFromCoordsStr(cmdParts[1])
+	ne = *getGeolocationFromCoordsStr(cmdParts[2])
+	depth, _ = strconv.Atoi(cmdParts[3])
+	if len(cmdParts) > 4 {
+		field = cmdParts[4]
+	}
+	return
+}
+
+func prepareClusterQueryArgs(cmdParts []string) (sw, ne ds.Position, zoom, samples int) {
+	sw = *getGeolocationFromCoordsStr(cmdParts[1])
+	ne = *getGeolocationFromCoordsStr(cmdParts[2])
+	zoom, _ = strconv.Atoi(cmdParts[3])
+	samples = 5
+	if len(cmdParts) > 4 {
+		samples, _ = strconv.Atoi(cmdParts[4])
+	}
+	return
+}
+
+func prepareGeohashQueryArgs(cmdParts []string) (geohash string, limit int) {
+	limit = 10
+	if len(cmdParts) > 2 {
+		limit, _ = strconv.Atoi(cmdParts[2])
+	}
+	return cmdParts[1], limit
+}
+
+func preparePolygonQueryArgs(cmdParts []string) (polygons []ds.Polygon, limit int) {
+	polygons, _ = ds.ParseGeoJSONPolygons([]byte(cmdParts[1]))
+	if len(cmdParts) > 2 {
+		limitTmp, err := strconv.Atoi(cmdParts[2])
+		if err == nil {
+			limit = limitTmp
+			return
+		}
+	}
+	limit = 10
+	return
+}
+
+func prepareGeofenceFromStr(cmdParts []string) (fence ds.Geofence) {
+	dwellPosition := 3
+	if polygons, err := ds.ParseGeoJSONPolygons([]byte(cmdParts[2])); err == nil {
+		fence = *ds.NewPolygonGeofence(cmdParts[1], polygons)
+	} else {
+		radius, _ := strconv.Atoi(cmdParts[3])
+		fence = *ds.NewCircularGeofence(cmdParts[1], *getGeolocationFromCoordsStr(cmdParts[2]), radius)
+		dwellPosition = 4
+	}
+	if len(cmdParts) > dwellPosition {
+		fence.DwellTime, _ = strconv.Atoi(cmdParts[dwellPosition])
+	}
+	return
+}
+
+func prepareShapeFromStr(cmdParts []string) (shape ds.Shape) {
+	shape, _ = ds.ParseGeoJSONShape(cmdParts[1], []byte(cmdParts[2]), prepareDataFromStr(cmdParts, 3))
+	return
+}
+
+func prepareNearbyShapesQueryArgs(cmdParts []string) (location ds.Position, radius, limit int) {
+	location = *getGeolocationFromCoordsStr(cmdParts[1])
+	radius, _ = strconv.Atoi(cmdParts[2])
+	limit = 10
+	if len(cmdParts) > 3 {
+		limit, _ = strconv.Atoi(cmdParts[3])
+	}
+	return
+}
+
+func prepareGeofenceEventsQueryArgs(cmdParts []string) (since uint64, limit int) {
+	limit = 100
+	if len(cmdParts) > 1 {
+		since, _ = strconv.ParseUint(cmdParts[1], 10, 64)
+	}
+	if len(cmdParts) > 2 {
+		if limitTmp, err := strconv.Atoi(cmdParts[2]); err == nil {
+			limit = limitTmp
+		}
+	}
+	return
+}
+
+func prepareHistoryQueryArgs(cmdParts []string) (locationID string, size int) {
+	size, _ = strconv.Atoi(cmdParts[2])
+	return cmdParts[1], size
+}
+
+func prepareTrajectoryQueryArgs(cmdParts []string) (locationID string, from, to int64) {
+	if len(cmdParts) > 2 {
+		from, _ = strconv.ParseInt(cmdParts[2], 10, 64)
+	}
+	if len(cmdParts) > 3 {
+		to, _ = strconv.ParseInt(cmdParts[3], 10, 64)
+	}
+	return cmdParts[1], from, to
+}
+
 func prepareDataFromStr(cmdParts []string, expectedPosition int) (data map[string]interface{}) {
 	if len(cmdParts) < expectedPosition+1 {
 		return make(map[string]interface{})
@@ -38,6 +178,14 @@ func prepareDataFromStr(cmdParts []string, expectedPosition int) (data map[strin
 	return
 }
 
+func prepareTTLFromStr(cmdParts []string, expectedPosition int) (ttl int) {
+	if len(cmdParts) < expectedPosition+1 {
+		return 0
+	}
+	ttl, _ = strconv.Atoi(cmdParts[expectedPosition])
+	return
+}
+
 func prepareBulkWriteOpsFromStr(bulkWriteStr string) (bulkWriteOps []store.Command) {
 	json.Unmarshal([]byte(bulkWriteStr), &bulkWriteOps)
 	return
@@ -3,7 +3,20 @@ package http
 import "errors"
 
 var (
-	ErrInvalidBody           = errors.New("body should be a valid JSON")
-	ErrInvalidData           = errors.New("data should be a valid JSON")
-	ErrInvalidBulkWriteArray = errors.New("body should contain an array of insert/update operations")
+	ErrInvalidBody             = errors.New("body should be a valid JSON")
+	ErrInvalidData             = errors.New("data should be a valid JSON")
+	ErrInvalidBulkWriteArray   = errors.New("body should contain an array of insert/update operations")
+	ErrInvalidTTL              = errors.New("ttl should be a non negative integer")
+	ErrInvalidRefreshTTL       = errors.New("refresh_ttl should be a boolean")
+	ErrInvalidBuffer           = errors.New("buffer should be a positive integer")
+	ErrInvalidDepth            = errors.New("depth should be a non negative integer")
+	ErrInvalidZoom             = errors.New("zoom should be a non negative integer")
+	ErrInvalidGeohashPrecision = errors.New("geohash should be a precision between 1 and 12")
+	ErrInvalidMaxAge           = errors.New("maxAge should be a non negative integer")
+	ErrInvalidHistorySize      = errors.New("size should be an integer")
+	ErrInvalidBox              = errors.New("minLat must be less than or equal to maxLat")
+	ErrInvalidWithData         = errors.New("data should be a boolean")
+	ErrInvalidAltitudeBand     = errors.New("minAlt must be less than or equal to maxAlt")
+	ErrInvalid3D               = errors.New("3d should be a boolean")
+	ErrInvalidCountLimit       = errors.New("limit should be a non negative integer")
 )
@@ -4,12 +4,16 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/quadrille/quadrille/core/ds"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"github.com/quadrille/quadrille/http/types"
 	"github.com/quadrille/quadrille/replication/store"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-func prepareUpdateArgs(r *http.Request) (latExists, lonExists, dataExists bool, locationID string, position *ds.Position, data map[string]interface{}, err error) {
+func prepareUpdateArgs(r *http.Request) (latExists, lonExists, dataExists bool, locationID string, position *ds.Position, data map[string]interface{}, ttl int, refreshTTL bool, err error) {
 	var leaf map[string]interface{}
 	if err = json.NewDecoder(r.Body).Decode(&leaf); err != nil {
 		err = ErrInvalidBody
@@ -34,7 +38,12 @@ func prepareUpdateArgs(r *http.Request) (latExists, lonExists, dataExists bool,
 			err = errTmp
 			return
 		}
-		position = ds.NewPosition(lat, lon)
+		alt, errTmp := getAltitudeFromBody(leaf)
+		if errTmp != nil {
+			err = errTmp
+			return
+		}
+		position = ds.NewPositionWithAltitude(lat, lon, alt)
 	}
 	dataTmp, dataExistsTmp := leaf["data"]
 	dataExists = dataExistsTmp
@@ -47,10 +56,19 @@ func prepareUpdateArgs(r *http.Request) (latExists, lonExists, dataExists bool,
 			return
 		}
 	}
+	if ttl, err = getTTLFromBody(leaf); err != nil {
+		return
+	}
+	if refreshTTLTmp, exists := leaf["refresh_ttl"]; exists {
+		refreshTTL, exists = refreshTTLTmp.(bool)
+		if !exists {
+			err = ErrInvalidRefreshTTL
+		}
+	}
 	return
 }
 
-func prepareInsertArgs(r *http.Request) (locationID string, position *ds.Position, data map[string]interface{}, err error) {
+func prepareInsertArgs(r *http.Request) (locationID string, position *ds.Position, data map[string]interface{}, ttl int, err error) {
 	var leaf map[string]interface{}
 	if err = json.NewDecoder(r.Body).Decode(&leaf); err != nil {
 		err = ErrInvalidBody
@@ -61,8 +79,18 @@ func prepareInsertArgs(r *http.Request) (locationID string, position *ds.Positio
 		return
 	}
 	lat, err := getFloatAttrFromBody(leaf, "lat")
+	if err != nil {
+		return
+	}
 	lon, err := getFloatAttrFromBody(leaf, "lon")
-	position = ds.NewPosition(lat, lon)
+	if err != nil {
+		return
+	}
+	alt, err := getAltitudeFromBody(leaf)
+	if err != nil {
+		return
+	}
+	position = ds.NewPositionWithAltitude(lat, lon, alt)
 	dataTmp, exists := leaf["data"]
 	if exists {
 		dataTmp, ok := dataTmp.(map[string]interface{})
@@ -73,10 +101,46 @@ func prepareInsertArgs(r *http.Request) (locationID string, position *ds.Positio
 			return
 		}
 	}
+	ttl, err = getTTLFromBody(leaf)
+	return
+}
+
+func prepareGetNeighborsArg(r *http.Request) (position *ds.Position, radius, limit int, filter ds.Filter, maxAge int, altitude ds.AltitudeQuery, err error) {
+	queryParamMap := r.URL.Query()
+	lat, err := getFloatParamFromQueryString(queryParamMap, "lat")
+	if err != nil {
+		return
+	}
+	lon, err := getFloatParamFromQueryString(queryParamMap, "lon")
+	if err != nil {
+		return
+	}
+	alt, altitude, err := getAltitudeQueryFromQueryString(queryParamMap)
+	if err != nil {
+		return
+	}
+	position = ds.NewPositionWithAltitude(lat, lon, alt)
+	radius, err = getIntParamFromQueryString(queryParamMap, "radius")
+	if err != nil {
+		return
+	}
+	if filterExpr := queryParamMap.Get("filter"); filterExpr != "" {
+		if filter, err = ds.ParseFilter(filterExpr); err != nil {
+			return
+		}
+	}
+	if maxAge, err = getMaxAgeFromQueryString(queryParamMap); err != nil {
+		return
+	}
+	limit, err = getIntParamFromQueryString(queryParamMap, "limit")
+	if err != nil {
+		err = nil
+		limit = 10
+	}
 	return
 }
 
-func prepareGetNeighborsArg(r *http.Request) (lat, lon float64, radius, limit int, err error) {
+func prepareGetNearestArgs(r *http.Request) (lat, lon float64, k, maxDistance int, err error) {
 	queryParamMap := r.URL.Query()
 	lat, err = getFloatParamFromQueryString(queryParamMap, "lat")
 	if err != nil {
@@ -86,8 +150,42 @@ func prepareGetNeighborsArg(r *http.Request) (lat, lon float64, radius, limit in
 	if err != nil {
 		return
 	}
-	radius, err = getIntParamFromQueryString(queryParamMap, "radius")
+	if _, ok := queryParamMap["maxDistance"]; ok {
+		maxDistance, err = getIntParamFromQueryString(queryParamMap, "maxDistance")
+		if err != nil {
+			return
+		}
+	}
+	k, err = getIntParamFromQueryString(queryParamMap, "k")
 	if err != nil {
+		err = nil
+		k = 10
+	}
+	return
+}
+
+func prepareGetWithinArgs(r *http.Request) (sw, ne *ds.Position, limit, maxAge int, err error) {
+	queryParamMap := r.URL.Query()
+	var minLat, minLon, maxLat, maxLon float64
+	if minLat, err = getFloatParamFromQueryString(queryParamMap, "minLat"); err != nil {
+		return
+	}
+	if minLon, err = getFloatParamFromQueryString(queryParamMap, "minLon"); err != nil {
+		return
+	}
+	if maxLat, err = getFloatParamFromQueryString(queryParamMap, "maxLat"); err != nil {
+		return
+	}
+	if maxLon, err = getFloatParamFromQueryString(queryParamMap, "maxLon"); err != nil {
+		return
+	}
+	//A minLon greater than maxLon denotes a box crossing the antimeridian
+	if minLat > maxLat {
+		err = ErrInvalidBox
+		return
+	}
+	sw, ne = ds.NewPosition(minLat, minLon), ds.NewPosition(maxLat, maxLon)
+	if maxAge, err = getMaxAgeFromQueryString(queryParamMap); err != nil {
 		return
 	}
 	limit, err = getIntParamFromQueryString(queryParamMap, "limit")
@@ -98,6 +196,244 @@ func prepareGetNeighborsArg(r *http.Request) (lat, lon float64, radius, limit in
 	return
 }
 
+func prepareGetAggregateArgs(r *http.Request) (sw, ne *ds.Position, depth int, field string, err error) {
+	if sw, ne, _, _, err = prepareGetWithinArgs(r); err != nil {
+		return
+	}
+	queryParamMap := r.URL.Query()
+	if depth, err = getIntParamFromQueryString(queryParamMap, "depth"); err != nil || depth < 0 {
+		err = ErrInvalidDepth
+		return
+	}
+	field = queryParamMap.Get("field")
+	return
+}
+
+func prepareGetClustersArgs(r *http.Request) (sw, ne *ds.Position, zoom, samples int, err error) {
+	if sw, ne, _, _, err = prepareGetWithinArgs(r); err != nil {
+		return
+	}
+	queryParamMap := r.URL.Query()
+	if zoom, err = getIntParamFromQueryString(queryParamMap, "zoom"); err != nil || zoom < 0 {
+		err = ErrInvalidZoom
+		return
+	}
+	samples, err = getIntParamFromQueryString(queryParamMap, "samples")
+	if err != nil || samples < 0 {
+		err = nil
+		samples = 5
+	}
+	return
+}
+
+func prepareGetWithinGeohashArgs(r *http.Request) (geohash string, limit int, err error) {
+	urlParts := strings.Split(r.URL.Path, "/")
+	if len(urlParts) < 3 || strings.TrimSpace(urlParts[2]) == "" {
+		err = errors.New("geohash expected in URL")
+		return
+	}
+	geohash = strings.TrimSpace(urlParts[2])
+	limit, err = getIntParamFromQueryString(r.URL.Query(), "limit")
+	if err != nil {
+		err = nil
+		limit = 10
+	}
+	return
+}
+
+func prepareDistanceMatrixArgs(r *http.Request) (origins, destinations []ds.MatrixPoint, err error) {
+	var matrix types.DistanceMatrix
+	if err = json.NewDecoder(r.Body).Decode(&matrix); err != nil {
+		if err != quadrilleError.ErrInvalidMatrix {
+			err = ErrInvalidBody
+		}
+		return
+	}
+	return matrix.Origins, matrix.Destinations, nil
+}
+
+func prepareGetAlongRouteArgs(r *http.Request) (route []ds.Position, buffer, limit int, err error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		err = ErrInvalidBody
+		return
+	}
+	if route, err = ds.ParseRoute(body); err != nil {
+		return
+	}
+	queryParamMap := r.URL.Query()
+	if buffer, err = getIntParamFromQueryString(queryParamMap, "buffer"); err != nil || buffer <= 0 {
+		err = ErrInvalidBuffer
+		return
+	}
+	limit, err = getIntParamFromQueryString(queryParamMap, "limit")
+	if err != nil {
+		err = nil
+		limit = 10
+	}
+	return
+}
+
+func prepareGetWithinPolygonArgs(r *http.Request) (polygons []ds.Polygon, limit int, err error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		err = ErrInvalidBody
+		return
+	}
+	if polygons, err = ds.ParseGeoJSONPolygons(body); err != nil {
+		return
+	}
+	limit, err = getIntParamFromQueryString(r.URL.Query(), "limit")
+	if err != nil {
+		err = nil
+		limit = 10
+	}
+	return
+}
+
+func prepareSetGeofenceArgs(r *http.Request) (fence ds.Geofence, err error) {
+	var geofence types.Geofence
+	if err = json.NewDecoder(r.Body).Decode(&geofence); err != nil {
+		err = ErrInvalidBody
+		return
+	}
+	if geofence.ID, err = getGeofenceID(r); err != nil {
+		return
+	}
+	return geofence.ToGeofence()
+}
+
+func prepareSetShapeArgs(r *http.Request) (shape ds.Shape, err error) {
+	var wireShape types.Shape
+	if err = json.NewDecoder(r.Body).Decode(&wireShape); err != nil {
+		err = ErrInvalidBody
+		return
+	}
+	if wireShape.ID, err = getShapeID(r); err != nil {
+		return
+	}
+	return wireShape.ToShape()
+}
+
+func prepareGetShapesNearbyArgs(r *http.Request) (lat, lon float64, radius, limit int, err error) {
+	queryParamMap := r.URL.Query()
+	if lat, err = getFloatParamFromQueryString(queryParamMap, "lat"); err != nil {
+		return
+	}
+	if lon, err = getFloatParamFromQueryString(queryParamMap, "lon"); err != nil {
+		return
+	}
+	if radius, err = getIntParamFromQueryString(queryParamMap, "radius"); err != nil {
+		return
+	}
+	limit, err = getIntParamFromQueryString(queryParamMap, "limit")
+	if err != nil {
+		err = nil
+		limit = 10
+	}
+	return
+}
+
+func prepareGetContainingArgs(r *http.Request) (lat, lon float64, withData bool, err error) {
+	queryParamMap := r.URL.Query()
+	if lat, err = getFloatParamFromQueryString(queryParamMap, "lat"); err != nil {
+		return
+	}
+	if lon, err = getFloatParamFromQueryString(queryParamMap, "lon"); err != nil {
+		return
+	}
+	if withDataStr := queryParamMap.Get("data"); withDataStr != "" {
+		if withData, err = strconv.ParseBool(withDataStr); err != nil {
+			err = ErrInvalidWithData
+		}
+	}
+	return
+}
+
+func prepareGetGeofenceEventsArgs(r *http.Request) (since uint64, limit int, err error) {
+	queryParamMap := r.URL.Query()
+	if sinceStr := queryParamMap.Get("since"); sinceStr != "" {
+		if since, err = strconv.ParseUint(sinceStr, 10, 64); err != nil {
+			err = errors.New("since must be a valid sequence number")
+			return
+		}
+	}
+	limit, err = getIntParamFromQueryString(queryParamMap, "limit")
+	if err != nil {
+		err = nil
+		limit = 100
+	}
+	return
+}
+
+func prepareSetHistoryArgs(r *http.Request) (locationID string, size int, err error) {
+	var body map[string]interface{}
+	if err = json.NewDecoder(r.Body).Decode(&body); err != nil {
+		err = ErrInvalidBody
+		return
+	}
+	if locationID, err = getLocationID(r); err != nil {
+		return
+	}
+	sizeTmp, err := getFloatAttrFromBody(body, "size")
+	if err != nil {
+		return
+	}
+	if sizeTmp != float64(int(sizeTmp)) {
+		err = ErrInvalidHistorySize
+		return
+	}
+	size = int(sizeTmp)
+	return
+}
+
+func prepareGetTrajectoryArgs(r *http.Request) (locationID string, from, to int64, err error) {
+	if locationID, err = getLocationID(r); err != nil {
+		return
+	}
+	queryParamMap := r.URL.Query()
+	if fromStr := queryParamMap.Get("from"); fromStr != "" {
+		if from, err = strconv.ParseInt(fromStr, 10, 64); err != nil {
+			err = errors.New("from must be a unix time in milliseconds")
+			return
+		}
+	}
+	if toStr := queryParamMap.Get("to"); toStr != "" {
+		if to, err = strconv.ParseInt(toStr, 10, 64); err != nil {
+			err = errors.New("to must be a unix time in milliseconds")
+			return
+		}
+	}
+	return
+}
+
+func prepareWatchArgs(r *http.Request) (options store.WatchOptions, sse bool, err error) {
+	queryParamMap := r.URL.Query()
+	sse = queryParamMap.Get("format") == "sse" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	fromStr := queryParamMap.Get("from")
+	if lastEventID := r.Header.Get("Last-Event-ID"); sse && lastEventID != "" {
+		//Resumption is inclusive of the index, so a reconnecting client may see the last entry again
+		fromStr = lastEventID
+	}
+	if fromStr != "" {
+		if options.FromIndex, err = strconv.ParseUint(fromStr, 10, 64); err != nil {
+			err = errors.New("from must be a valid raft index")
+			return
+		}
+	}
+	options.Prefix = queryParamMap.Get("prefix")
+	if _, ok := queryParamMap["minLat"]; ok {
+		var sw, ne *ds.Position
+		if sw, ne, _, _, err = prepareGetWithinArgs(r); err != nil {
+			return
+		}
+		if options.Region, err = store.NewWatchRegion(sw, ne); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func prepareBulkWriteCommands(r *http.Request) (commands []store.Command, err error) {
 	if err = json.NewDecoder(r.Body).Decode(&commands); err != nil {
 		err = ErrInvalidBulkWriteArray
@@ -128,6 +464,22 @@ func prepareJoinArgs(r *http.Request) (nodeID, remoteAddr string, err error) {
 	return
 }
 
+func getGeofenceID(r *http.Request) (string, error) {
+	urlParts := strings.Split(r.URL.Path, "/")
+	if len(urlParts) < 3 || strings.TrimSpace(urlParts[2]) == "" {
+		return "", errors.New("geofence id expected in URL")
+	}
+	return strings.TrimSpace(urlParts[2]), nil
+}
+
+func getShapeID(r *http.Request) (string, error) {
+	urlParts := strings.Split(r.URL.Path, "/")
+	if len(urlParts) < 3 || strings.TrimSpace(urlParts[2]) == "" {
+		return "", errors.New("shape id expected in URL")
+	}
+	return strings.TrimSpace(urlParts[2]), nil
+}
+
 func getLocationID(r *http.Request) (string, error) {
 	urlParts := strings.Split(r.URL.Path, "/")
 	if len(urlParts) < 3 || urlParts[2] == "" {
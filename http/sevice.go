@@ -5,7 +5,9 @@ package http
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/quadrille/quadrille/core/ds"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
 	"github.com/quadrille/quadrille/http/types"
 	"github.com/quadrille/quadrille/replication/store"
 	"io"
@@ -77,12 +79,79 @@ func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		default:
 			w.WriteHeader(http.StatusNotFound)
 		}
+	} else if strings.HasPrefix(r.URL.Path, "/geofence/") {
+		switch r.Method {
+		case "GET":
+			s.getGeofence(w, r)
+		case "PUT":
+			s.setGeofence(w, r)
+		case "DELETE":
+			s.deleteGeofence(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	} else if strings.HasPrefix(r.URL.Path, "/shape/") {
+		switch r.Method {
+		case "GET":
+			s.getShape(w, r)
+		case "PUT":
+			s.setShape(w, r)
+		case "DELETE":
+			s.deleteShape(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	} else if strings.HasPrefix(r.URL.Path, "/history/") {
+		switch r.Method {
+		case "GET":
+			s.getTrajectory(w, r)
+		case "PUT":
+			s.setHistory(w, r)
+		case "DELETE":
+			s.deleteHistory(w, r)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	} else if r.URL.Path == "/geofences" {
+		s.getGeofences(w, r)
+	} else if r.URL.Path == "/geofences/events" {
+		s.getGeofenceEvents(w, r)
+	} else if r.URL.Path == "/shapes/nearby" {
+		s.getShapesNearby(w, r)
+	} else if r.URL.Path == "/containing" {
+		s.getContaining(w, r)
 	} else if r.URL.Path == "/neighbors" {
 		s.getNeighbors(w, r)
+	} else if r.URL.Path == "/neighbors/count" {
+		s.countNeighbors(w, r)
+	} else if r.URL.Path == "/within" {
+		s.getWithin(w, r)
+	} else if r.URL.Path == "/within/count" {
+		s.countWithin(w, r)
+	} else if r.URL.Path == "/polygon" {
+		s.getWithinPolygon(w, r)
+	} else if r.URL.Path == "/polygon/count" {
+		s.countWithinPolygon(w, r)
+	} else if r.URL.Path == "/aggregate" {
+		s.getAggregate(w, r)
+	} else if r.URL.Path == "/cluster" {
+		s.getClusters(w, r)
+	} else if strings.HasPrefix(r.URL.Path, "/geohash/") {
+		s.getWithinGeohash(w, r)
+	} else if r.URL.Path == "/corridor" {
+		s.getAlongRoute(w, r)
+	} else if r.URL.Path == "/nearest" {
+		s.getNearest(w, r)
+	} else if r.URL.Path == "/matrix" {
+		s.getDistanceMatrix(w, r)
+	} else if r.URL.Path == "/watch" {
+		s.handleWatch(w, r)
 	} else if r.URL.Path == "/join" {
 		s.handleJoin(w, r)
 	} else if r.URL.Path == "/remove" {
 		s.handleRemove(w, r)
+	} else if r.URL.Path == "/stats" {
+		s.getStats(w, r)
 	} else if r.URL.Path == "/leader" {
 		s.getLeader(w, r)
 	} else if r.URL.Path == "/members" {
@@ -130,6 +199,12 @@ func (s *Service) handleRemove(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (s *Service) getStats(w http.ResponseWriter, r *http.Request) {
+	statsStr, _ := json.Marshal(s.store.Stats())
+	setContentTypeJSON(w)
+	io.WriteString(w, string(statsStr))
+}
+
 func (s *Service) getLeader(w http.ResponseWriter, r *http.Request) {
 	io.WriteString(w, string(s.store.GetLeader()))
 }
@@ -150,6 +225,11 @@ func (s *Service) getLocation(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+	projection, err := getProjectionFromQueryString(r.URL.Query())
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
 	leaf, err := s.store.Get(locationID)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -157,11 +237,16 @@ func (s *Service) getLocation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	b, err := json.Marshal(map[string]interface{}{
-		"lat":  leaf.GetLocation().Lat(),
-		"long": leaf.GetLocation().Long(),
-		"data": leaf.Data,
-	})
+	location := map[string]interface{}{
+		"lat":        leaf.GetLocation().Lat(),
+		"long":       leaf.GetLocation().Long(),
+		"data":       projection.Apply(leaf.Data),
+		"updated_at": leaf.UpdatedAt,
+	}
+	if alt := leaf.GetLocation().Alt(); alt != 0 {
+		location["alt"] = alt
+	}
+	b, err := json.Marshal(location)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -185,13 +270,16 @@ func (s *Service) deleteLocation(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) insert(w http.ResponseWriter, r *http.Request) {
-	locationID, position, data, err := prepareInsertArgs(r)
+	locationID, position, data, ttl, err := prepareInsertArgs(r)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	if err := s.store.Insert(locationID, position, data); err != nil {
+	if err := s.store.Insert(locationID, position, data, ttl); err == quadrilleError.ErrPositionOutOfBounds {
+		respondWithErr(w, err)
+		return
+	} else if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -199,16 +287,16 @@ func (s *Service) insert(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) update(w http.ResponseWriter, r *http.Request) {
-	latExists, lonExists, dataExists, locationID, position, data, err := prepareUpdateArgs(r)
+	latExists, lonExists, dataExists, locationID, position, data, ttl, refreshTTL, err := prepareUpdateArgs(r)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		w.Write([]byte(err.Error()))
 		return
 	}
 	if latExists && lonExists && dataExists {
-		err = s.store.Update(locationID, position, data)
+		err = s.store.Update(locationID, position, data, ttl)
 	} else if latExists && lonExists {
-		err = s.store.UpdateLocation(locationID, position)
+		err = s.store.UpdateLocation(locationID, position, refreshTTL)
 	} else if dataExists {
 		err = s.store.UpdateData(locationID, data)
 	} else {
@@ -223,16 +311,368 @@ func (s *Service) update(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) getNeighbors(w http.ResponseWriter, r *http.Request) {
-	lat, lon, radius, limit, err := prepareGetNeighborsArg(r)
+	position, radius, limit, filter, maxAge, altitude, err := prepareGetNeighborsArg(r)
 	if err != nil {
 		respondWithErr(w, err)
 		return
 	}
-	neighbors := s.store.GetNeighbors(*ds.NewPosition(lat, lon), radius, limit)
-	neighborsStr, _ := json.Marshal(types.PrepareNeighborResults(neighbors))
-	resp := string(neighborsStr)
+	neighbors := s.store.GetNeighbors(*position, radius, limit, filter, maxAge, altitude)
+	writeNeighborResults(w, r, neighbors, s.store.IsPlanar())
+}
+
+func (s *Service) countNeighbors(w http.ResponseWriter, r *http.Request) {
+	position, radius, _, filter, maxAge, altitude, err := prepareGetNeighborsArg(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	limit, err := getCountLimitFromQueryString(r.URL.Query())
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	writeCount(w, s.store.CountNeighbors(*position, radius, filter, maxAge, altitude, limit))
+}
+
+func (s *Service) getNearest(w http.ResponseWriter, r *http.Request) {
+	lat, lon, k, maxDistance, err := prepareGetNearestArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	nearest := s.store.GetNearest(*ds.NewPosition(lat, lon), k, maxDistance)
+	writeNeighborResults(w, r, nearest, s.store.IsPlanar())
+}
+
+func (s *Service) getDistanceMatrix(w http.ResponseWriter, r *http.Request) {
+	origins, destinations, err := prepareDistanceMatrixArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	distances, err := s.store.DistanceMatrix(origins, destinations)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	resultsStr, _ := json.Marshal(map[string][][]float64{"distances": distances})
 	setContentTypeJSON(w)
-	io.WriteString(w, resp)
+	io.WriteString(w, string(resultsStr))
+}
+
+func (s *Service) getWithin(w http.ResponseWriter, r *http.Request) {
+	sw, ne, limit, maxAge, err := prepareGetWithinArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	locations := s.store.GetLocationsInBox(*sw, *ne, limit, maxAge)
+	writeNeighborResults(w, r, locations, s.store.IsPlanar())
+}
+
+func (s *Service) countWithin(w http.ResponseWriter, r *http.Request) {
+	sw, ne, _, maxAge, err := prepareGetWithinArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	limit, err := getCountLimitFromQueryString(r.URL.Query())
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	writeCount(w, s.store.CountLocationsInBox(*sw, *ne, maxAge, limit))
+}
+
+func (s *Service) getAggregate(w http.ResponseWriter, r *http.Request) {
+	sw, ne, depth, field, err := prepareGetAggregateArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	cellsStr, _ := json.Marshal(s.store.Aggregate(*sw, *ne, depth, field))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(cellsStr))
+}
+
+func (s *Service) getClusters(w http.ResponseWriter, r *http.Request) {
+	sw, ne, zoom, samples, err := prepareGetClustersArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	clustersStr, _ := json.Marshal(s.store.GetClusters(*sw, *ne, zoom, samples))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(clustersStr))
+}
+
+func (s *Service) getWithinGeohash(w http.ResponseWriter, r *http.Request) {
+	geohash, limit, err := prepareGetWithinGeohashArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	locations, err := s.store.GetLocationsInGeohash(geohash, limit)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	writeNeighborResults(w, r, locations, s.store.IsPlanar())
+}
+
+func (s *Service) getAlongRoute(w http.ResponseWriter, r *http.Request) {
+	route, buffer, limit, err := prepareGetAlongRouteArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	projection, err := getProjectionFromQueryString(r.URL.Query())
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	resultsStr, _ := json.Marshal(types.PrepareCorridorResults(s.store.GetLocationsAlongRoute(route, buffer, limit), projection))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(resultsStr))
+}
+
+func (s *Service) getWithinPolygon(w http.ResponseWriter, r *http.Request) {
+	polygons, limit, err := prepareGetWithinPolygonArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	locations := s.store.GetLocationsInPolygon(polygons, limit)
+	writeNeighborResults(w, r, locations, s.store.IsPlanar())
+}
+
+func (s *Service) countWithinPolygon(w http.ResponseWriter, r *http.Request) {
+	polygons, _, err := prepareGetWithinPolygonArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	limit, err := getCountLimitFromQueryString(r.URL.Query())
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	writeCount(w, s.store.CountLocationsInPolygon(polygons, limit))
+}
+
+func (s *Service) getGeofence(w http.ResponseWriter, r *http.Request) {
+	id, err := getGeofenceID(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	fence, err := s.store.GetGeofence(id)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	fenceStr, _ := json.Marshal(types.NewGeofence(fence))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(fenceStr))
+}
+
+func (s *Service) setGeofence(w http.ResponseWriter, r *http.Request) {
+	fence, err := prepareSetGeofenceArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	if err := s.store.SetGeofence(fence); err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func (s *Service) deleteGeofence(w http.ResponseWriter, r *http.Request) {
+	id, err := getGeofenceID(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	if err := s.store.DeleteGeofence(id); err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func (s *Service) getShape(w http.ResponseWriter, r *http.Request) {
+	id, err := getShapeID(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	shape, err := s.store.GetShape(id)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	shapeStr, _ := json.Marshal(types.NewShape(shape))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(shapeStr))
+}
+
+func (s *Service) setShape(w http.ResponseWriter, r *http.Request) {
+	shape, err := prepareSetShapeArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	if err := s.store.SetShape(shape); err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func (s *Service) deleteShape(w http.ResponseWriter, r *http.Request) {
+	id, err := getShapeID(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	if err := s.store.DeleteShape(id); err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func (s *Service) getShapesNearby(w http.ResponseWriter, r *http.Request) {
+	lat, lon, radius, limit, err := prepareGetShapesNearbyArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	resultsStr, _ := json.Marshal(types.PrepareShapeResults(s.store.GetShapesNearby(*ds.NewPosition(lat, lon), radius, limit)))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(resultsStr))
+}
+
+func (s *Service) getContaining(w http.ResponseWriter, r *http.Request) {
+	lat, lon, withData, err := prepareGetContainingArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	resultsStr, _ := json.Marshal(types.PrepareContainingShapes(s.store.GetShapesContaining(*ds.NewPosition(lat, lon)), withData))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(resultsStr))
+}
+
+func (s *Service) getGeofences(w http.ResponseWriter, r *http.Request) {
+	fencesStr, _ := json.Marshal(types.PrepareGeofences(s.store.GetGeofences()))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(fencesStr))
+}
+
+func (s *Service) getGeofenceEvents(w http.ResponseWriter, r *http.Request) {
+	since, limit, err := prepareGetGeofenceEventsArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	eventsStr, _ := json.Marshal(s.store.GetGeofenceEvents(since, limit))
+	setContentTypeJSON(w)
+	io.WriteString(w, string(eventsStr))
+}
+
+func (s *Service) getTrajectory(w http.ResponseWriter, r *http.Request) {
+	locationID, from, to, err := prepareGetTrajectoryArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	trajectory, err := s.store.GetTrajectory(locationID, from, to)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	trajectoryStr, _ := json.Marshal(trajectory)
+	setContentTypeJSON(w)
+	io.WriteString(w, string(trajectoryStr))
+}
+
+func (s *Service) setHistory(w http.ResponseWriter, r *http.Request) {
+	locationID, size, err := prepareSetHistoryArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	if err := s.store.SetHistory(locationID, size); err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+func (s *Service) deleteHistory(w http.ResponseWriter, r *http.Request) {
+	locationID, err := getLocationID(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	if err := s.store.SetHistory(locationID, 0); err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	io.WriteString(w, "ok")
+}
+
+//Streams the applied commands as newline delimited JSON, or as Server-Sent Events when requested
+func (s *Service) handleWatch(w http.ResponseWriter, r *http.Request) {
+	options, sse, err := prepareWatchArgs(r)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	watcher, err := s.store.Watch(options)
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	defer watcher.Close()
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case e, ok := <-watcher.Events():
+			if !ok {
+				if err := watcher.Err(); err != nil {
+					writeWatchError(w, err, sse)
+					flusher.Flush()
+				}
+				return
+			}
+			eventStr, _ := json.Marshal(e)
+			if sse {
+				fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Index, eventStr)
+			} else {
+				fmt.Fprintf(w, "%s\n", eventStr)
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
 }
 
 func (s *Service) handleBulkWrite(w http.ResponseWriter, r *http.Request) {
@@ -241,7 +681,10 @@ func (s *Service) handleBulkWrite(w http.ResponseWriter, r *http.Request) {
 		respondWithErr(w, err)
 		return
 	}
-	s.store.BulkWrite(commands)
+	if err := s.store.BulkWrite(commands); err == quadrilleError.ErrPositionOutOfBounds || err == store.ErrUnsupportedBulkOperation {
+		respondWithErr(w, err)
+		return
+	}
 	io.WriteString(w, "ok")
 }
 
@@ -0,0 +1,54 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/quadrille/quadrille/core/ds"
+)
+
+//Geofence is the wire format of a geofence. Circular geofences have Lat, Lon and Radius
+//whereas polygonal ones have a GeoJSON Polygon or MultiPolygon Geometry.
+type Geofence struct {
+	ID        string                 `json:"id,omitempty"`
+	Lat       *float64               `json:"lat,omitempty"`
+	Lon       *float64               `json:"lon,omitempty"`
+	Radius    int                    `json:"radius,omitempty"`
+	Geometry  json.RawMessage        `json:"geometry,omitempty"`
+	DwellTime int                    `json:"dwell,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+func NewGeofence(fence ds.Geofence) *Geofence {
+	g := &Geofence{ID: fence.ID, DwellTime: fence.DwellTime, Data: fence.Data}
+	if fence.IsCircular() {
+		lat, lon := fence.Center.Lat(), fence.Center.Long()
+		g.Lat, g.Lon, g.Radius = &lat, &lon, fence.Radius
+	} else {
+		g.Geometry, _ = ds.PolygonsToGeoJSON(fence.Polygons)
+	}
+	return g
+}
+
+//ToGeofence converts the wire format to a ds.Geofence, validating the shape
+func (g Geofence) ToGeofence() (ds.Geofence, error) {
+	var fence ds.Geofence
+	if g.Geometry != nil {
+		polygons, err := ds.ParseGeoJSONPolygons(g.Geometry)
+		if err != nil {
+			return fence, err
+		}
+		fence = *ds.NewPolygonGeofence(g.ID, polygons)
+	} else if g.Lat != nil && g.Lon != nil {
+		fence = *ds.NewCircularGeofence(g.ID, *ds.NewPosition(*g.Lat, *g.Lon), g.Radius)
+	}
+	fence.DwellTime = g.DwellTime
+	fence.Data = g.Data
+	return fence, fence.Validate()
+}
+
+func PrepareGeofences(fences []ds.Geofence) []Geofence {
+	results := make([]Geofence, 0)
+	for _, fence := range fences {
+		results = append(results, *NewGeofence(fence))
+	}
+	return results
+}
@@ -0,0 +1,9 @@
+package types
+
+import "github.com/quadrille/quadrille/core/ds"
+
+//DistanceMatrix is the wire format of a distance matrix query. Each point is either a location ID or a {"lat": .., "lon": ..} object.
+type DistanceMatrix struct {
+	Origins      []ds.MatrixPoint `json:"origins"`
+	Destinations []ds.MatrixPoint `json:"destinations"`
+}
@@ -5,25 +5,52 @@ import "github.com/quadrille/quadrille/core/ds"
 type NeighborResult struct {
 	Latitude   float64
 	Longitude  float64
+	Altitude   float64 `json:",omitempty"`
 	LocationID string
 	Distance   float64
 	Data       map[string]interface{}
+	UpdatedAt  int64
+	Geohash    string `json:",omitempty"`
 }
 
-func NewNeighborResult(r ds.QuadTreeNeighborResult) *NeighborResult {
+//NewNeighborResult converts the result, keeping only the parts of its data selected by the projection
+func NewNeighborResult(r ds.QuadTreeNeighborResult, projection ds.Projection) *NeighborResult {
 	return &NeighborResult{
 		Latitude:   r.Leaf.GetLocation().Lat(),
 		Longitude:  r.Leaf.GetLocation().Long(),
+		Altitude:   r.Leaf.GetLocation().Alt(),
 		LocationID: r.Leaf.GetLocationID(),
 		Distance:   r.Distance,
-		Data:       r.Leaf.Data,
+		Data:       projection.Apply(r.Leaf.Data),
+		UpdatedAt:  r.Leaf.UpdatedAt,
 	}
 }
 
-func PrepareNeighborResults(neighbors []ds.QuadTreeNeighborResult) []NeighborResult {
+func PrepareNeighborResults(neighbors []ds.QuadTreeNeighborResult, projection ds.Projection) []NeighborResult {
 	results := make([]NeighborResult, 0)
 	for _, result := range neighbors {
-		results = append(results, *NewNeighborResult(result))
+		results = append(results, *NewNeighborResult(result, projection))
+	}
+	return results
+}
+
+//AddGeohashes sets the geohash of the given precision on each of the results
+func AddGeohashes(results []NeighborResult, precision int) {
+	for i := range results {
+		results[i].Geohash = ds.Geohash(ds.NewPosition(results[i].Latitude, results[i].Longitude), precision)
+	}
+}
+
+//CorridorResult is a NeighborResult along with its distance along the route of a corridor query
+type CorridorResult struct {
+	NeighborResult
+	DistanceAlongRoute float64
+}
+
+func PrepareCorridorResults(corridorResults []ds.CorridorResult, projection ds.Projection) []CorridorResult {
+	results := make([]CorridorResult, 0)
+	for _, result := range corridorResults {
+		results = append(results, CorridorResult{NeighborResult: *NewNeighborResult(result.QuadTreeNeighborResult, projection), DistanceAlongRoute: result.DistanceAlongRoute})
 	}
 	return results
 }
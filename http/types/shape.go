@@ -0,0 +1,57 @@
+package types
+
+import (
+	"encoding/json"
+	"github.com/quadrille/quadrille/core/ds"
+)
+
+//Shape is the wire format of a shape, whose Geometry is a GeoJSON Polygon, MultiPolygon or LineString
+type Shape struct {
+	ID        string                 `json:"id,omitempty"`
+	Geometry  json.RawMessage        `json:"geometry,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	UpdatedAt int64                  `json:"updated_at,omitempty"`
+}
+
+func NewShape(shape ds.Shape) *Shape {
+	s := &Shape{ID: shape.ID, Data: shape.Data, UpdatedAt: shape.UpdatedAt}
+	if shape.IsLine() {
+		s.Geometry, _ = ds.LineStringToGeoJSON(shape.Line)
+	} else {
+		s.Geometry, _ = ds.PolygonsToGeoJSON(shape.Polygons)
+	}
+	return s
+}
+
+//ToShape converts the wire format to a ds.Shape, validating the geometry
+func (s Shape) ToShape() (ds.Shape, error) {
+	return ds.ParseGeoJSONShape(s.ID, s.Geometry, s.Data)
+}
+
+//PrepareContainingShapes returns the shapes found by a point lookup without their geometries, which its callers
+//already know, and without their data unless withData is set
+func PrepareContainingShapes(shapes []ds.Shape, withData bool) []Shape {
+	results := make([]Shape, 0)
+	for _, shape := range shapes {
+		result := Shape{ID: shape.ID, UpdatedAt: shape.UpdatedAt}
+		if withData {
+			result.Data = shape.Data
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+//ShapeResult is a shape along with its distance from the location of a query
+type ShapeResult struct {
+	Shape
+	Distance float64 `json:"distance"`
+}
+
+func PrepareShapeResults(shapeResults []ds.ShapeResult) []ShapeResult {
+	results := make([]ShapeResult, 0)
+	for _, result := range shapeResults {
+		results = append(results, ShapeResult{Shape: *NewShape(result.Shape), Distance: result.Distance})
+	}
+	return results
+}
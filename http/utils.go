@@ -1,7 +1,13 @@
 package http
 
 import (
+	"encoding/json"
 	"fmt"
+	"github.com/quadrille/quadrille/core/ds"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
+	"github.com/quadrille/quadrille/core/utils"
+	"github.com/quadrille/quadrille/http/types"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -46,6 +52,127 @@ func getFloatAttrFromBody(body map[string]interface{}, attrName string) (float64
 	return 0, fmt.Errorf("missing %s", attrName)
 }
 
+//Returns the optional maxAge in seconds from the query string, 0 if absent
+func getMaxAgeFromQueryString(queryParamMap url.Values) (int, error) {
+	if _, ok := queryParamMap["maxAge"]; !ok {
+		return 0, nil
+	}
+	maxAge, err := getIntParamFromQueryString(queryParamMap, "maxAge")
+	if err != nil || maxAge < 0 {
+		return 0, ErrInvalidMaxAge
+	}
+	return maxAge, nil
+}
+
+//Returns the optional alt in metres from the body, 0 if absent
+func getAltitudeFromBody(body map[string]interface{}) (float64, error) {
+	if _, ok := body["alt"]; !ok {
+		return 0, nil
+	}
+	return getFloatAttrFromBody(body, "alt")
+}
+
+//Returns the optional alt of the queried position, along with the altitude band given by minAlt and maxAlt
+//and whether 3d distances were requested
+func getAltitudeQueryFromQueryString(queryParamMap url.Values) (alt float64, altitude ds.AltitudeQuery, err error) {
+	if _, ok := queryParamMap["alt"]; ok {
+		if alt, err = getFloatParamFromQueryString(queryParamMap, "alt"); err != nil {
+			return
+		}
+	}
+	for paramName, bound := range map[string]**float64{"minAlt": &altitude.MinAlt, "maxAlt": &altitude.MaxAlt} {
+		if _, ok := queryParamMap[paramName]; ok {
+			val, errTmp := getFloatParamFromQueryString(queryParamMap, paramName)
+			if errTmp != nil {
+				err = errTmp
+				return
+			}
+			*bound = &val
+		}
+	}
+	if altitude.MinAlt != nil && altitude.MaxAlt != nil && *altitude.MinAlt > *altitude.MaxAlt {
+		err = ErrInvalidAltitudeBand
+		return
+	}
+	if use3DStr := queryParamMap.Get("3d"); use3DStr != "" {
+		if altitude.Use3D, err = strconv.ParseBool(use3DStr); err != nil {
+			err = ErrInvalid3D
+		}
+	}
+	return
+}
+
+//Returns the optional ttl in seconds from the body, 0 if absent
+func getTTLFromBody(body map[string]interface{}) (int, error) {
+	val, ok := body["ttl"]
+	if !ok {
+		return 0, nil
+	}
+	ttl, ok := val.(float64)
+	if !ok || ttl < 0 || ttl != float64(int(ttl)) {
+		return 0, ErrInvalidTTL
+	}
+	return int(ttl), nil
+}
+
+//Returns the optional limit up to which a count query counts, 0 counting every match if absent
+func getCountLimitFromQueryString(queryParamMap url.Values) (int, error) {
+	if _, ok := queryParamMap["limit"]; !ok {
+		return 0, nil
+	}
+	limit, err := getIntParamFromQueryString(queryParamMap, "limit")
+	if err != nil || limit < 0 {
+		return 0, ErrInvalidCountLimit
+	}
+	return limit, nil
+}
+
+func writeCount(w http.ResponseWriter, count int) {
+	countStr, _ := json.Marshal(map[string]int{"count": count})
+	setContentTypeJSON(w)
+	io.WriteString(w, string(countStr))
+}
+
+//Returns the optional projection given as comma separated data keys by fields, nil if absent
+func getProjectionFromQueryString(queryParamMap url.Values) (ds.Projection, error) {
+	return ds.ParseProjection(queryParamMap.Get("fields"))
+}
+
+//Writes the results as JSON, along with the geohash of each result if a precision was requested.
+//Only the parts of their data selected by the fields requested are written.
+func writeNeighborResults(w http.ResponseWriter, r *http.Request, neighbors []ds.QuadTreeNeighborResult, planar bool) {
+	projection, err := getProjectionFromQueryString(r.URL.Query())
+	if err != nil {
+		respondWithErr(w, err)
+		return
+	}
+	results := types.PrepareNeighborResults(neighbors, projection)
+	if _, ok := r.URL.Query()["geohash"]; ok {
+		if planar {
+			respondWithErr(w, quadrilleError.ErrGeohashOnPlanar)
+			return
+		}
+		precision, err := getIntParamFromQueryString(r.URL.Query(), "geohash")
+		if err != nil || precision < 1 || precision > utils.MaxGeohashPrecision {
+			respondWithErr(w, ErrInvalidGeohashPrecision)
+			return
+		}
+		types.AddGeohashes(results, precision)
+	}
+	resultsStr, _ := json.Marshal(results)
+	setContentTypeJSON(w)
+	io.WriteString(w, string(resultsStr))
+}
+
+func writeWatchError(w http.ResponseWriter, err error, sse bool) {
+	if sse {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", err.Error())
+		return
+	}
+	errStr, _ := json.Marshal(map[string]string{"error": err.Error()})
+	fmt.Fprintf(w, "%s\n", errStr)
+}
+
 func respondWithErr(w http.ResponseWriter, err error) {
 	w.WriteHeader(http.StatusBadRequest)
 	w.Write([]byte(err.Error()))
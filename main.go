@@ -6,13 +6,16 @@ import (
 	"flag"
 	"fmt"
 	"github.com/quadrille/quadrille/constants"
+	"github.com/quadrille/quadrille/core/ds"
 	httpd "github.com/quadrille/quadrille/http"
+	"github.com/quadrille/quadrille/opt"
 	"github.com/quadrille/quadrille/replication/store"
 	"github.com/quadrille/quadrille/tcp"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 )
 
@@ -27,6 +30,8 @@ var nodeID string
 var bindToHost bool
 var bindIP string
 var dbPath string
+var distanceModel string
+var worldBounds string
 
 func init() {
 	flag.StringVar(&httpPort, "h", constants.DefaultHTTPPort, "Set the HTTP port")
@@ -37,6 +42,8 @@ func init() {
 	flag.BoolVar(&bindToHost, "bindToHost", false, "Bind to Hostname")
 	flag.StringVar(&bindIP, "bindIP", "", "Bind IP")
 	flag.StringVar(&dbPath, "dbPath", "", "DB Data Path")
+	flag.StringVar(&distanceModel, "distance", "haversine", "Distance model: haversine, vincenty or planar")
+	flag.StringVar(&worldBounds, "bounds", "", "Hold planar x,y coordinates within minX,minY,maxX,maxY instead of latitudes and longitudes")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] <raft-data-path> \n", os.Args[0])
 		flag.PrintDefaults()
@@ -107,7 +114,24 @@ func startHTTPListener(httpAddr string, s store.Store) {
 }
 
 func prepareAndOpenRaftStore(raftDir string, raftAddr string, nodeID string) store.Store {
-	s := store.New(raftDir, raftAddr)
+	model, err := ds.ParseDistanceModel(distanceModel)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+	treeOptions := []ds.QuadTreeOption{ds.WithDistanceModel(model)}
+	if worldBounds != "" {
+		//Planar coordinates are always measured by the planar model, so any other one asked for could not be honoured
+		if isFlagSet("distance") && model != ds.Planar {
+			log.Fatalln("-bounds holds planar coordinates, which can only be combined with -distance planar")
+		}
+		minX, minY, maxX, maxY, err := parseBounds(worldBounds)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+		treeOptions = append(treeOptions, ds.WithPlanarBounds(minX, minY, maxX, maxY))
+		opt.SetWorldBounds(minY, minX, maxY, maxX)
+	}
+	s := store.New(raftDir, raftAddr, treeOptions...)
 	//Open Raft storage
 	if err := s.Open(joinAddr == "", nodeID); err != nil {
 		log.Fatalf("failed to open store: %s", err.Error())
@@ -115,6 +139,38 @@ func prepareAndOpenRaftStore(raftDir string, raftAddr string, nodeID string) sto
 	return s
 }
 
+//Reports whether the flag was given on the command line rather than left to its default
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+//Parses bounds given as minX,minY,maxX,maxY
+func parseBounds(bounds string) (minX, minY, maxX, maxY float64, err error) {
+	parts := strings.Split(bounds, ",")
+	if len(parts) != 4 {
+		err = fmt.Errorf("bounds should be minX,minY,maxX,maxY")
+		return
+	}
+	var values [4]float64
+	for i, part := range parts {
+		if values[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			err = fmt.Errorf("bounds should be minX,minY,maxX,maxY")
+			return
+		}
+	}
+	minX, minY, maxX, maxY = values[0], values[1], values[2], values[3]
+	if minX >= maxX || minY >= maxY {
+		err = fmt.Errorf("bounds should have minX less than maxX and minY less than maxY")
+	}
+	return
+}
+
 func getListenerAddresses(hostname, httpPort, raftPort, tcpPort string) (httpAddr, raftAddr, tcpAddr string) {
 	httpAddr = hostname + ":" + httpPort
 	raftAddr = hostname + ":" + raftPort
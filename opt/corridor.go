@@ -0,0 +1,59 @@
+package opt
+
+import (
+	"errors"
+	"github.com/quadrille/quadrille/core/ds"
+	"strconv"
+	"strings"
+)
+
+const Corridor = "corridor"
+
+//ParseCorridorArgs parses `corridor <lat,lon> <lat,lon>... <buffer> [limit]` where the positions may
+//instead be given as a single GeoJSON LineString
+func ParseCorridorArgs(cmdParts []string) (route []ds.Position, buffer, limit int, err error) {
+	args := cmdParts[1:]
+	if len(args) > 0 && strings.HasPrefix(args[0], "{") {
+		if route, err = ds.ParseRoute([]byte(args[0])); err != nil {
+			return
+		}
+		args = args[1:]
+	} else {
+		for len(args) > 0 && strings.Contains(args[0], ",") {
+			if !isValidCoords(args[0]) {
+				err = InvalidLatLon
+				return
+			}
+			latLong := strings.Split(args[0], ",")
+			lat, _ := strconv.ParseFloat(latLong[0], 64)
+			long, _ := strconv.ParseFloat(latLong[1], 64)
+			route = append(route, *ds.NewPosition(lat, long))
+			args = args[1:]
+		}
+		if len(route) < 2 {
+			err = errors.New("corridor needs a route of at least 2 lat,lon positions or a GeoJSON LineString")
+			return
+		}
+	}
+	if len(args) == 0 {
+		err = errors.New("corridor needs a buffer in metres")
+		return
+	}
+	if buffer, err = strconv.Atoi(args[0]); err != nil || buffer <= 0 {
+		err = errors.New("buffer should be a positive integer")
+		return
+	}
+	limit = 10
+	if len(args) > 1 {
+		if limit, err = strconv.Atoi(args[1]); err != nil || limit <= 0 {
+			err = errors.New("limit should be a positive integer")
+			return
+		}
+	}
+	return
+}
+
+func validateCorridor(cmdParts []string) error {
+	_, _, _, err := ParseCorridorArgs(cmdParts)
+	return err
+}
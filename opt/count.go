@@ -0,0 +1,33 @@
+package opt
+
+import (
+	"errors"
+	"strconv"
+)
+
+const Count = "count"
+
+//Queries which may be counted, along with the position of their optional limit, which caps the count instead
+var countableQueries = map[string]int{Neighbors: 3, Within: 3, Polygon: 2}
+
+//Validates `count <neighbors|within|polygon> <args of the query>`
+func validateCount(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("count needs a neighbors, within or polygon query")
+	}
+	if _, ok := countableQueries[cmdParts[1]]; !ok {
+		return errors.New("count needs a neighbors, within or polygon query")
+	}
+	return NewValidator(cmdParts[1])(cmdParts[1:])
+}
+
+//CountLimit returns the limit of the counted query, up to which its matches are counted, or 0 to count all of them
+func CountLimit(query []string) int {
+	position := countableQueries[query[0]]
+	if len(query) > position {
+		if limit, err := strconv.Atoi(query[position]); err == nil {
+			return limit
+		}
+	}
+	return 0
+}
@@ -3,6 +3,7 @@ package opt
 import "errors"
 
 var (
-	InvalidLatLon = errors.New("invalid lat,lon")
-	InvalidData   = errors.New("data must be a valid JSON (without any enclosing quotes)")
+	InvalidLatLon       = errors.New("invalid lat,lon")
+	InvalidData         = errors.New("data must be a valid JSON (without any enclosing quotes)")
+	InvalidAltitudeBand = errors.New("alt should be given as alt=<min>:<max> with min not above max")
 )
@@ -0,0 +1,63 @@
+package opt
+
+import (
+	"errors"
+	"github.com/quadrille/quadrille/core/ds"
+	"strconv"
+	"strings"
+)
+
+const Matrix = "matrix"
+
+//Separates the origins of a distance matrix from its destinations
+const matrixSeparator = "to"
+
+//ParseMatrixArgs parses `matrix <location_id|lat,lon>... to <location_id|lat,lon>...`
+func ParseMatrixArgs(cmdParts []string) (origins, destinations []ds.MatrixPoint, err error) {
+	args := cmdParts[1:]
+	separator := -1
+	for i, arg := range args {
+		if arg == matrixSeparator {
+			separator = i
+			break
+		}
+	}
+	if separator <= 0 || separator == len(args)-1 {
+		err = errors.New("matrix needs origins and destinations separated by `to`, each a location_id or lat,lon")
+		return
+	}
+	if origins, err = parseMatrixPoints(args[:separator]); err != nil {
+		return
+	}
+	if destinations, err = parseMatrixPoints(args[separator+1:]); err != nil {
+		return
+	}
+	if len(origins)*len(destinations) > ds.MaxMatrixPairs {
+		err = errors.New("matrix should have at most " + strconv.Itoa(ds.MaxMatrixPairs) + " origin-destination pairs")
+	}
+	return
+}
+
+//Arguments containing a comma are positions, the others location IDs
+func parseMatrixPoints(args []string) ([]ds.MatrixPoint, error) {
+	points := make([]ds.MatrixPoint, 0, len(args))
+	for _, arg := range args {
+		if !strings.Contains(arg, ",") {
+			points = append(points, ds.MatrixPoint{LocationID: arg})
+			continue
+		}
+		if !isValidCoords(arg) {
+			return nil, InvalidLatLon
+		}
+		latLong := strings.Split(arg, ",")
+		lat, _ := strconv.ParseFloat(latLong[0], 64)
+		long, _ := strconv.ParseFloat(latLong[1], 64)
+		points = append(points, ds.MatrixPoint{Position: ds.NewPosition(lat, long)})
+	}
+	return points, nil
+}
+
+func validateMatrix(cmdParts []string) error {
+	_, _, err := ParseMatrixArgs(cmdParts)
+	return err
+}
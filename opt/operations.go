@@ -17,20 +17,65 @@ const (
 	Update            = "update"
 	UpdateLocation    = "updateloc"
 	UpdateData        = "updatedata"
+	RefreshTTL        = "refresh"
 	Join              = "join"
 	Remove            = "removenode"
 	Neighbors         = "neighbors"
+	Within            = "within"
+	Polygon           = "polygon"
+	Geohash           = "geohash"
+	Nearest           = "nearest"
+	Aggregate         = "aggregate"
+	Cluster           = "cluster"
+	SetGeofence       = "setgeofence"
+	GetGeofence       = "getgeofence"
+	DeleteGeofence    = "delgeofence"
+	Geofences         = "geofences"
+	SetShape          = "setshape"
+	GetShape          = "getshape"
+	DeleteShape       = "delshape"
+	NearbyShapes      = "nearshapes"
+	Containing        = "containing"
+	WithData          = "data"
+	GeofenceEvents    = "geofenceevents"
+	SetHistory        = "sethistory"
+	Trajectory        = "trajectory"
+	Stats             = "stats"
 	BulkWrite         = "bulkwrite"
 )
 
 type QuadrilleService interface {
-	GetLocation(locationID string) (body string, err error)
+	GetLocation(locationID string, fields ds.Projection) (body string, err error)
 	DeleteLocation(locationID string) (body string, err error)
-	Insert(locationID string, location ds.Position, data map[string]interface{}) (body string, err error)
-	Update(locationID string, location ds.Position, data map[string]interface{}) (body string, err error)
-	UpdateLocation(locationID string, location ds.Position) (body string, err error)
+	Insert(locationID string, location ds.Position, data map[string]interface{}, ttl int) (body string, err error)
+	Update(locationID string, location ds.Position, data map[string]interface{}, ttl int) (body string, err error)
+	UpdateLocation(locationID string, location ds.Position, refreshTTL bool) (body string, err error)
 	UpdateData(locationID string, data map[string]interface{}) (body string, err error)
-	Neighbors(location ds.Position, radius, limit int) (body string, err error)
+	Neighbors(location ds.Position, radius, limit int, filter string, maxAge int, altitude ds.AltitudeQuery, fields ds.Projection) (body string, err error)
+	Within(sw, ne ds.Position, limit, maxAge int, fields ds.Projection) (body string, err error)
+	Polygon(polygons []ds.Polygon, limit int, fields ds.Projection) (body string, err error)
+	CountNeighbors(location ds.Position, radius int, filter string, maxAge int, altitude ds.AltitudeQuery, limit int) (body string, err error)
+	CountWithin(sw, ne ds.Position, maxAge, limit int) (body string, err error)
+	CountPolygon(polygons []ds.Polygon, limit int) (body string, err error)
+	Geohash(geohash string, limit int, fields ds.Projection) (body string, err error)
+	Corridor(route []ds.Position, buffer, limit int, fields ds.Projection) (body string, err error)
+	Nearest(location ds.Position, k, maxDistance int, fields ds.Projection) (body string, err error)
+	DistanceMatrix(origins, destinations []ds.MatrixPoint) (body string, err error)
+	Aggregate(sw, ne ds.Position, depth int, field string) (body string, err error)
+	Cluster(sw, ne ds.Position, zoom, samples int) (body string, err error)
+	SetGeofence(fence ds.Geofence) (body string, err error)
+	GetGeofence(id string) (body string, err error)
+	DeleteGeofence(id string) (body string, err error)
+	Geofences() (body string, err error)
+	SetShape(shape ds.Shape) (body string, err error)
+	GetShape(id string) (body string, err error)
+	DeleteShape(id string) (body string, err error)
+	NearbyShapes(location ds.Position, radius, limit int) (body string, err error)
+	Containing(location ds.Position, withData bool) (body string, err error)
+	GeofenceEvents(since uint64, limit int) (body string, err error)
+	SetHistory(locationID string, size int) (body string, err error)
+	Trajectory(locationID string, from, to int64) (body string, err error)
+	Stats() (body string, err error)
 	IsLeader() (body string, err error)
 	Leader() (body string, err error)
 	Members() (body string, err error)
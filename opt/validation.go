@@ -3,6 +3,7 @@ package opt
 import (
 	"encoding/json"
 	"errors"
+	"github.com/quadrille/quadrille/core/ds"
 	"strconv"
 	"strings"
 )
@@ -20,6 +21,28 @@ func init() {
 	validatorMap[UpdateData] = validateUpdateData
 	validatorMap[DeleteLocation] = validateDel
 	validatorMap[Neighbors] = validateNeighbors
+	validatorMap[Within] = validateWithin
+	validatorMap[Polygon] = validatePolygon
+	validatorMap[Nearest] = validateNearest
+	validatorMap[SetGeofence] = validateSetGeofence
+	validatorMap[GetGeofence] = validateGeofenceID
+	validatorMap[DeleteGeofence] = validateGeofenceID
+	validatorMap[GeofenceEvents] = validateGeofenceEvents
+	validatorMap[SetShape] = validateSetShape
+	validatorMap[GetShape] = validateShapeID
+	validatorMap[DeleteShape] = validateShapeID
+	validatorMap[NearbyShapes] = validateNearbyShapes
+	validatorMap[Containing] = validateContaining
+	validatorMap[SetHistory] = validateSetHistory
+	validatorMap[Aggregate] = validateAggregate
+	validatorMap[Cluster] = validateCluster
+	validatorMap[Geohash] = validateGeohash
+	validatorMap[Trajectory] = validateTrajectory
+	validatorMap[Watch] = validateWatch
+	validatorMap[Corridor] = validateCorridor
+	validatorMap[Matrix] = validateMatrix
+	validatorMap[Count] = validateCount
+	validatorMap[Unwatch] = validateUnwatch
 	validatorMap[Join] = validateAddNode
 }
 
@@ -50,6 +73,15 @@ func validateAddNode(cmdParts []string) error {
 	return nil
 }
 
+//Bounds of valid coordinates as minLat,minLon,maxLat,maxLon, the range of latitudes and longitudes unless set otherwise
+var worldBounds = [4]float64{-90, -180, 90, 180}
+
+//SetWorldBounds makes coordinates valid within the given bounds rather than the range of latitudes and longitudes,
+//as for a server holding planar coordinates, whose y and x take the place of lat and lon
+func SetWorldBounds(minLat, minLon, maxLat, maxLon float64) {
+	worldBounds = [4]float64{minLat, minLon, maxLat, maxLon}
+}
+
 func isValidCoords(coords string) bool {
 	latLong := strings.Split(coords, ",")
 	if len(latLong) != 2 {
@@ -58,14 +90,114 @@ func isValidCoords(coords string) bool {
 	latStr, longStr := latLong[0], latLong[1]
 	lat, latErr := strconv.ParseFloat(latStr, 64)
 	long, longErr := strconv.ParseFloat(longStr, 64)
-	return !(latErr != nil || longErr != nil || lat < -90 || lat > 90 || long < -180 || long > 180)
+	return !(latErr != nil || longErr != nil || lat < worldBounds[0] || lat > worldBounds[2] || long < worldBounds[1] || long > worldBounds[3])
+}
+
+//Accepts lat,lon or lat,lon,alt with the altitude in metres, for the commands making use of the altitude
+func isValidCoordsWithAltitude(coords string) bool {
+	parts := strings.Split(coords, ",")
+	if len(parts) != 3 {
+		return isValidCoords(coords)
+	}
+	_, err := strconv.ParseFloat(parts[2], 64)
+	return err == nil && isValidCoords(parts[0]+","+parts[1])
+}
+
+//Prefix of the optional trailing argument of neighbors and within which excludes locations written more than the given seconds ago
+const maxAgePrefix = "maxage="
+
+//SplitMaxAge strips the optional trailing maxage=<seconds> argument, returning 0 if it is absent
+func SplitMaxAge(cmdParts []string) ([]string, int, error) {
+	if len(cmdParts) < 2 || !strings.HasPrefix(cmdParts[len(cmdParts)-1], maxAgePrefix) {
+		return cmdParts, 0, nil
+	}
+	maxAge, err := strconv.Atoi(strings.TrimPrefix(cmdParts[len(cmdParts)-1], maxAgePrefix))
+	if err != nil || maxAge < 0 {
+		return cmdParts, 0, errors.New("maxage should be a non negative integer")
+	}
+	return cmdParts[:len(cmdParts)-1], maxAge, nil
+}
+
+//Prefix of the optional argument of get and the location queries selecting the data keys to return, as comma separated
+//dot separated paths
+const fieldsPrefix = "fields="
+
+//Commands accepting a fields=<keys> argument
+var projectableCommands = map[string]bool{GetLocation: true, Neighbors: true, Nearest: true, Within: true, Polygon: true, Geohash: true, Corridor: true}
+
+//SplitFields strips the optional fields=<keys> argument of get and the location queries wherever it follows the command,
+//returning a nil projection if it is absent
+func SplitFields(cmdParts []string) ([]string, ds.Projection, error) {
+	if !projectableCommands[cmdParts[0]] {
+		return cmdParts, nil, nil
+	}
+	for i := 1; i < len(cmdParts); i++ {
+		if strings.HasPrefix(cmdParts[i], fieldsPrefix) {
+			projection, err := ds.ParseProjection(strings.TrimPrefix(cmdParts[i], fieldsPrefix))
+			if err != nil {
+				return cmdParts, nil, err
+			}
+			return append(cmdParts[:i:i], cmdParts[i+1:]...), projection, nil
+		}
+	}
+	return cmdParts, nil, nil
+}
+
+//Optional argument of neighbors measuring distances in 3d, taking the altitudes into account
+const use3DArg = "3d"
+
+//Prefix of the optional argument of neighbors restricting matches to altitudes within min:max metres, either bound may be left out
+const altitudeBandPrefix = "alt="
+
+//SplitAltitude strips the optional trailing 3d and alt=<min>:<max> arguments of neighbors, in either order
+func SplitAltitude(cmdParts []string) ([]string, ds.AltitudeQuery, error) {
+	var altitude ds.AltitudeQuery
+	for len(cmdParts) > 2 {
+		last := cmdParts[len(cmdParts)-1]
+		switch {
+		case last == use3DArg:
+			altitude.Use3D = true
+		case strings.HasPrefix(last, altitudeBandPrefix):
+			bounds := strings.Split(strings.TrimPrefix(last, altitudeBandPrefix), ":")
+			if len(bounds) != 2 {
+				return cmdParts, altitude, InvalidAltitudeBand
+			}
+			limits := [2]*float64{}
+			for i, bound := range bounds {
+				if bound == "" {
+					continue
+				}
+				val, err := strconv.ParseFloat(bound, 64)
+				if err != nil {
+					return cmdParts, altitude, InvalidAltitudeBand
+				}
+				limits[i] = &val
+			}
+			if limits[0] != nil && limits[1] != nil && *limits[0] > *limits[1] {
+				return cmdParts, altitude, InvalidAltitudeBand
+			}
+			altitude.MinAlt, altitude.MaxAlt = limits[0], limits[1]
+		default:
+			return cmdParts, altitude, nil
+		}
+		cmdParts = cmdParts[:len(cmdParts)-1]
+	}
+	return cmdParts, altitude, nil
 }
 
 func validateNeighbors(cmdParts []string) error {
+	cmdParts, _, err := SplitMaxAge(cmdParts)
+	if err != nil {
+		return err
+	}
+	cmdParts, _, err = SplitAltitude(cmdParts)
+	if err != nil {
+		return err
+	}
 	if len(cmdParts) < 2 {
 		return errors.New("neighbors needs a lat,lon")
 	}
-	if !isValidCoords(cmdParts[1]) {
+	if !isValidCoordsWithAltitude(cmdParts[1]) {
 		return InvalidLatLon
 	}
 
@@ -77,6 +209,238 @@ func validateNeighbors(cmdParts []string) error {
 	if err != nil || radius == 0 {
 		return errors.New("radius should be a positive integer")
 	}
+
+	//The limit is optional, so the filter may either follow it or take its place
+	if len(cmdParts) >= 4 {
+		filterExpr := cmdParts[len(cmdParts)-1]
+		if _, err := strconv.Atoi(cmdParts[3]); err == nil && len(cmdParts) == 4 {
+			return nil
+		}
+		if _, err := ds.ParseFilter(filterExpr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateNearest(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("nearest needs a lat,lon")
+	}
+	if !isValidCoords(cmdParts[1]) {
+		return InvalidLatLon
+	}
+	if len(cmdParts) >= 3 {
+		if k, err := strconv.Atoi(cmdParts[2]); err != nil || k <= 0 {
+			return errors.New("k should be a positive integer")
+		}
+	}
+	if len(cmdParts) >= 4 {
+		if maxDistance, err := strconv.Atoi(cmdParts[3]); err != nil || maxDistance < 0 {
+			return errors.New("max distance should be a non-negative integer")
+		}
+	}
+	return nil
+}
+
+func validateWithin(cmdParts []string) error {
+	cmdParts, _, err := SplitMaxAge(cmdParts)
+	if err != nil {
+		return err
+	}
+	if len(cmdParts) < 3 {
+		return errors.New("within needs a minLat,minLon and maxLat,maxLon")
+	}
+	if !isValidCoords(cmdParts[1]) || !isValidCoords(cmdParts[2]) {
+		return InvalidLatLon
+	}
+	sw, ne := strings.Split(cmdParts[1], ","), strings.Split(cmdParts[2], ",")
+	minLat, _ := strconv.ParseFloat(sw[0], 64)
+	maxLat, _ := strconv.ParseFloat(ne[0], 64)
+	//A minLon greater than maxLon denotes a box crossing the antimeridian
+	if minLat > maxLat {
+		return errors.New("minLat must be less than or equal to maxLat")
+	}
+	return nil
+}
+
+func validateAggregate(cmdParts []string) error {
+	if len(cmdParts) < 4 {
+		return errors.New("aggregate needs a minLat,minLon maxLat,maxLon and depth")
+	}
+	if err := validateWithin(cmdParts[:3]); err != nil {
+		return err
+	}
+	if depth, err := strconv.Atoi(cmdParts[3]); err != nil || depth < 0 {
+		return errors.New("depth should be a non negative integer")
+	}
+	return nil
+}
+
+func validateCluster(cmdParts []string) error {
+	if len(cmdParts) < 4 {
+		return errors.New("cluster needs a minLat,minLon maxLat,maxLon and zoom")
+	}
+	if err := validateWithin(cmdParts[:3]); err != nil {
+		return err
+	}
+	if zoom, err := strconv.Atoi(cmdParts[3]); err != nil || zoom < 0 {
+		return errors.New("zoom should be a non negative integer")
+	}
+	if len(cmdParts) >= 5 {
+		if samples, err := strconv.Atoi(cmdParts[4]); err != nil || samples < 0 {
+			return errors.New("samples should be a non negative integer")
+		}
+	}
+	return nil
+}
+
+func validateGeohash(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("geohash needs a geohash")
+	}
+	if _, err := ds.GeohashBounds(cmdParts[1]); err != nil {
+		return err
+	}
+	if len(cmdParts) >= 3 {
+		if limit, err := strconv.Atoi(cmdParts[2]); err != nil || limit <= 0 {
+			return errors.New("limit should be a positive integer")
+		}
+	}
+	return nil
+}
+
+func validatePolygon(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("polygon needs a GeoJSON Polygon or MultiPolygon")
+	}
+	if _, err := ds.ParseGeoJSONPolygons([]byte(cmdParts[1])); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateSetGeofence(cmdParts []string) error {
+	if len(cmdParts) < 3 {
+		return errors.New("setgeofence needs an id and either lat,lon radius or a GeoJSON Polygon or MultiPolygon")
+	}
+	dwellPosition := 3
+	if isValidCoords(cmdParts[2]) {
+		if len(cmdParts) < 4 {
+			return errors.New("setgeofence needs a radius")
+		}
+		if radius, err := strconv.Atoi(cmdParts[3]); err != nil || radius <= 0 {
+			return errors.New("radius should be a positive integer")
+		}
+		dwellPosition = 4
+	} else if _, err := ds.ParseGeoJSONPolygons([]byte(cmdParts[2])); err != nil {
+		return err
+	}
+	if len(cmdParts) > dwellPosition {
+		if dwell, err := strconv.Atoi(cmdParts[dwellPosition]); err != nil || dwell < 0 {
+			return errors.New("dwell time should be a non-negative integer")
+		}
+	}
+	return nil
+}
+
+func validateGeofenceID(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("operation needs a geofence id")
+	}
+	return nil
+}
+
+func validateSetShape(cmdParts []string) error {
+	if len(cmdParts) < 3 {
+		return errors.New("setshape needs an id and a GeoJSON Polygon, MultiPolygon or LineString")
+	}
+	if _, err := ds.ParseGeoJSONShape(cmdParts[1], []byte(cmdParts[2]), nil); err != nil {
+		return err
+	}
+	if len(cmdParts) > 3 {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(cmdParts[3]), &data); err != nil {
+			return InvalidData
+		}
+	}
+	return nil
+}
+
+func validateShapeID(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("operation needs a shape id")
+	}
+	return nil
+}
+
+func validateNearbyShapes(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("nearshapes needs a lat,lon")
+	}
+	if !isValidCoords(cmdParts[1]) {
+		return InvalidLatLon
+	}
+	if len(cmdParts) < 3 {
+		return errors.New("nearshapes needs a radius")
+	}
+	if radius, err := strconv.Atoi(cmdParts[2]); err != nil || radius < 0 {
+		return errors.New("radius should be a non negative integer")
+	}
+	if len(cmdParts) > 3 {
+		if limit, err := strconv.Atoi(cmdParts[3]); err != nil || limit <= 0 {
+			return errors.New("limit should be a positive integer")
+		}
+	}
+	return nil
+}
+
+func validateContaining(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("containing needs a lat,lon")
+	}
+	if !isValidCoords(cmdParts[1]) {
+		return InvalidLatLon
+	}
+	if len(cmdParts) > 2 && cmdParts[2] != WithData {
+		return errors.New("containing only accepts `data` after the lat,lon")
+	}
+	return nil
+}
+
+func validateGeofenceEvents(cmdParts []string) error {
+	if len(cmdParts) >= 2 {
+		if _, err := strconv.ParseUint(cmdParts[1], 10, 64); err != nil {
+			return errors.New("since should be a valid sequence number")
+		}
+	}
+	if len(cmdParts) >= 3 {
+		if limit, err := strconv.Atoi(cmdParts[2]); err != nil || limit <= 0 {
+			return errors.New("limit should be a positive integer")
+		}
+	}
+	return nil
+}
+
+func validateSetHistory(cmdParts []string) error {
+	if len(cmdParts) < 3 {
+		return errors.New("sethistory needs a location_id and the number of positions to retain")
+	}
+	if size, err := strconv.Atoi(cmdParts[2]); err != nil || size < 0 {
+		return errors.New("size should be a non negative integer")
+	}
+	return nil
+}
+
+func validateTrajectory(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("trajectory needs a location_id")
+	}
+	for _, timeStr := range cmdParts[2:] {
+		if _, err := strconv.ParseInt(timeStr, 10, 64); err != nil {
+			return errors.New("from and to should be unix times in milliseconds")
+		}
+	}
 	return nil
 }
 
@@ -84,12 +448,17 @@ func validateInsertOrUpdate(cmdParts []string) error {
 	if len(cmdParts) < 3 {
 		return errors.New("operation needs a location_id and lat,long")
 	}
-	if !isValidCoords(cmdParts[2]) {
+	if !isValidCoordsWithAltitude(cmdParts[2]) {
 		return InvalidLatLon
 	}
 	if len(cmdParts) >= 4 && !isDataValid(cmdParts[3]) {
 		return InvalidData
 	}
+	if len(cmdParts) >= 5 {
+		if ttl, err := strconv.Atoi(cmdParts[4]); err != nil || ttl < 0 {
+			return errors.New("ttl should be a non negative integer")
+		}
+	}
 	return nil
 }
 
@@ -97,9 +466,12 @@ func validateUpdateLocation(cmdParts []string) error {
 	if len(cmdParts) < 3 {
 		return errors.New("updateloc needs a location_id and lat,long")
 	}
-	if !isValidCoords(cmdParts[2]) {
+	if !isValidCoordsWithAltitude(cmdParts[2]) {
 		return InvalidLatLon
 	}
+	if len(cmdParts) >= 4 && cmdParts[3] != RefreshTTL {
+		return errors.New("updateloc only accepts " + RefreshTTL + " after lat,long")
+	}
 	return nil
 }
 
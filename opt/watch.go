@@ -0,0 +1,59 @@
+package opt
+
+import (
+	"errors"
+	"github.com/quadrille/quadrille/core/ds"
+	"github.com/quadrille/quadrille/replication/store"
+	"strconv"
+	"strings"
+)
+
+const (
+	Watch   = "watch"
+	Unwatch = "unwatch"
+)
+
+//ParseWatchArgs parses `watch [from=<index>] [prefix=<location_id prefix>] [within=minLat,minLon,maxLat,maxLon]`
+func ParseWatchArgs(cmdParts []string) (options store.WatchOptions, err error) {
+	for _, arg := range cmdParts[1:] {
+		keyVal := strings.SplitN(arg, "=", 2)
+		if len(keyVal) != 2 {
+			return options, errors.New("watch options must be of the form key=value")
+		}
+		switch keyVal[0] {
+		case "from":
+			if options.FromIndex, err = strconv.ParseUint(keyVal[1], 10, 64); err != nil {
+				return options, errors.New("from should be a valid raft index")
+			}
+		case "prefix":
+			options.Prefix = keyVal[1]
+		case "within":
+			bounds := strings.Split(keyVal[1], ",")
+			if len(bounds) != 4 || !isValidCoords(bounds[0]+","+bounds[1]) || !isValidCoords(bounds[2]+","+bounds[3]) {
+				return options, errors.New("within should be minLat,minLon,maxLat,maxLon")
+			}
+			minLat, _ := strconv.ParseFloat(bounds[0], 64)
+			minLon, _ := strconv.ParseFloat(bounds[1], 64)
+			maxLat, _ := strconv.ParseFloat(bounds[2], 64)
+			maxLon, _ := strconv.ParseFloat(bounds[3], 64)
+			if options.Region, err = store.NewWatchRegion(ds.NewPosition(minLat, minLon), ds.NewPosition(maxLat, maxLon)); err != nil {
+				return options, err
+			}
+		default:
+			return options, errors.New("watch supports from, prefix and within options")
+		}
+	}
+	return options, nil
+}
+
+func validateWatch(cmdParts []string) error {
+	_, err := ParseWatchArgs(cmdParts)
+	return err
+}
+
+func validateUnwatch(cmdParts []string) error {
+	if len(cmdParts) < 2 {
+		return errors.New("unwatch needs the query id of the watch")
+	}
+	return nil
+}
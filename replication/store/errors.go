@@ -9,4 +9,6 @@ var (
 	ErrAddressNotReachable       = errors.New("address not reachable")
 	ErrNonExistentLocationDelete = errors.New("cannot delete non existent location")
 	ErrNonLeaderNode             = fmt.Errorf("cannot execute operation not leader")
+	ErrLocationNotExpired        = errors.New("location has not expired")
+	ErrUnsupportedBulkOperation  = errors.New("bulk write operations must be one of insert, update, updateloc, updatedata, delete")
 )
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+//Interval at which the leader looks for expired locations
+const expiryCheckInterval = time.Second
+
+//Maximum number of expired locations deleted by a single Raft log entry
+const expiryBatchSize = 1000
+
+type expiryEntry struct {
+	TTL       int   `json:"ttl"`        //Seconds
+	ExpiresAt int64 `json:"expires_at"` //Unix time in milliseconds
+}
+
+//expiryTracker holds the expiry of the locations which were written with a TTL
+type expiryTracker struct {
+	mtx     sync.RWMutex
+	entries map[string]expiryEntry
+}
+
+func newExpiryTracker() *expiryTracker {
+	return &expiryTracker{entries: map[string]expiryEntry{}}
+}
+
+//set makes the location expire ttl seconds after the timestamp, or never if ttl is 0
+func (t *expiryTracker) set(locationID string, ttl int, timestamp int64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if ttl <= 0 {
+		delete(t.entries, locationID)
+		return
+	}
+	t.entries[locationID] = expiryEntry{TTL: ttl, ExpiresAt: timestamp + int64(ttl)*1000}
+}
+
+//refresh restarts the TTL of the location, if it has one, from the timestamp
+func (t *expiryTracker) refresh(locationID string, timestamp int64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if entry, ok := t.entries[locationID]; ok {
+		entry.ExpiresAt = timestamp + int64(entry.TTL)*1000
+		t.entries[locationID] = entry
+	}
+}
+
+func (t *expiryTracker) remove(locationID string) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	delete(t.entries, locationID)
+}
+
+func (t *expiryTracker) isExpired(locationID string, timestamp int64) bool {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	entry, ok := t.entries[locationID]
+	return ok && entry.ExpiresAt <= timestamp
+}
+
+//expired returns up to limit locations which have expired by the timestamp, earliest expiry first
+func (t *expiryTracker) expired(timestamp int64, limit int) []string {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	locationIDs := []string{}
+	for locationID, entry := range t.entries {
+		if entry.ExpiresAt <= timestamp {
+			locationIDs = append(locationIDs, locationID)
+		}
+	}
+	sort.Slice(locationIDs, func(i, j int) bool {
+		return t.entries[locationIDs[i]].ExpiresAt < t.entries[locationIDs[j]].ExpiresAt
+	})
+	if len(locationIDs) > limit {
+		locationIDs = locationIDs[:limit]
+	}
+	return locationIDs
+}
+
+func (t *expiryTracker) state() map[string]expiryEntry {
+	t.mtx.RLock()
+	defer t.mtx.RUnlock()
+	state := make(map[string]expiryEntry, len(t.entries))
+	for locationID, entry := range t.entries {
+		state[locationID] = entry
+	}
+	return state
+}
+
+func (t *expiryTracker) restore(state map[string]expiryEntry) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.entries = make(map[string]expiryEntry, len(state))
+	for locationID, entry := range state {
+		t.entries[locationID] = entry
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"testing"
+)
+
+func TestExpiry(t *testing.T) {
+	f := (*fsm)(New("", "").(*store))
+	applyCommands(t, f, 1,
+		Command{Op: string(OperationInsert), LocationID: "cab", Lat: 13.1980, Long: 77.7060, TTL: 10, Timestamp: 1000},
+		Command{Op: string(OperationInsert), LocationID: "bike", Lat: 13.1980, Long: 77.7060, TTL: 30, Timestamp: 1000},
+		Command{Op: string(OperationInsert), LocationID: "depot", Lat: 13.1980, Long: 77.7060, Timestamp: 1000})
+
+	if expired := f.expiry.expired(11000, expiryBatchSize); len(expired) != 1 || expired[0] != "cab" {
+		t.Fatalf("Expected only cab to have expired, got %v", expired)
+	}
+
+	applyCommands(t, f, 2, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.1981, Long: 77.7061, RefreshTTL: true, Timestamp: 9000})
+	applyCommands(t, f, 3, Command{Op: string(OperationExpire), LocationID: "cab", Timestamp: 11000})
+	if _, err := f.q.Get("cab"); err != nil {
+		t.Fatalf("Expected refreshed cab to survive expire, got %s", err.Error())
+	}
+
+	applyCommands(t, f, 4,
+		Command{Op: string(OperationExpire), LocationID: "cab", Timestamp: 31000},
+		Command{Op: string(OperationExpire), LocationID: "bike", Timestamp: 31000},
+		Command{Op: string(OperationExpire), LocationID: "depot", Timestamp: 31000})
+	if _, err := f.q.Get("cab"); err == nil {
+		t.Fatalf("Expected cab to have expired")
+	}
+	if _, err := f.q.Get("bike"); err == nil {
+		t.Fatalf("Expected bike to have expired")
+	}
+	if _, err := f.q.Get("depot"); err != nil {
+		t.Fatalf("Expected depot without ttl to never expire, got %s", err.Error())
+	}
+	if expired := f.expiry.expired(1<<62, expiryBatchSize); len(expired) != 0 {
+		t.Fatalf("Expected no pending expiries, got %v", expired)
+	}
+}
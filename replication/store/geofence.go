@@ -0,0 +1,225 @@
+package store
+
+import (
+	"github.com/quadrille/quadrille/core/ds"
+	"sort"
+	"sync"
+)
+
+type GeofenceEventType string
+
+const (
+	GeofenceEnter GeofenceEventType = "enter"
+	GeofenceExit  GeofenceEventType = "exit"
+	GeofenceDwell GeofenceEventType = "dwell"
+)
+
+// Number of most recent geofence events retained by each node
+const geofenceEventBufferSize = 10000
+
+// GeofenceEvent is produced when a location enters, exits or dwells in a geofence.
+// Seq is local to the node whereas Index is the Raft log index of the write which produced the event.
+type GeofenceEvent struct {
+	Seq        uint64            `json:"seq"`
+	Index      uint64            `json:"index"`
+	Type       GeofenceEventType `json:"type"`
+	GeofenceID string            `json:"geofence_id"`
+	LocationID string            `json:"location_id"`
+	Lat        float64           `json:"lat"`
+	Long       float64           `json:"lon"`
+	Timestamp  int64             `json:"ts"`
+}
+
+type geofenceMembership struct {
+	EnteredAt int64 `json:"entered_at"`
+	Dwelled   bool  `json:"dwelled"`
+}
+
+// geofenceState is the replicated part of the geofence tracker, included in snapshots
+type geofenceState struct {
+	Geofences  map[string]ds.Geofence                    `json:"geofences"`
+	Membership map[string]map[string]*geofenceMembership `json:"membership"`
+}
+
+type geofenceTracker struct {
+	mtx        sync.RWMutex
+	fences     map[string]ds.Geofence
+	membership map[string]map[string]*geofenceMembership //Geofences containing each location, keyed by location_id and geofence id
+	distance   ds.DistanceModel                          //Measures the radius of circular geofences
+	events     []GeofenceEvent
+	lastSeq    uint64
+}
+
+func newGeofenceTracker(distance ds.DistanceModel) *geofenceTracker {
+	return &geofenceTracker{
+		fences:     map[string]ds.Geofence{},
+		membership: map[string]map[string]*geofenceMembership{},
+		distance:   distance,
+	}
+}
+
+// set adds or replaces a geofence. The locations already inside it are recorded without producing enter events.
+func (g *geofenceTracker) set(e logEntry, fence ds.Geofence, insideLocationIDs []string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.fences[fence.ID] = fence
+	inside := make(map[string]bool, len(insideLocationIDs))
+	for _, locationID := range insideLocationIDs {
+		inside[locationID] = true
+		if _, ok := g.membership[locationID][fence.ID]; !ok {
+			g.addMembership(locationID, fence.ID, e.timestamp)
+		}
+	}
+	for locationID, fences := range g.membership {
+		if _, ok := fences[fence.ID]; ok && !inside[locationID] {
+			g.removeMembership(locationID, fence.ID)
+		}
+	}
+}
+
+func (g *geofenceTracker) delete(fenceID string) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	delete(g.fences, fenceID)
+	for locationID := range g.membership {
+		g.removeMembership(locationID, fenceID)
+	}
+}
+
+func (g *geofenceTracker) get(fenceID string) (ds.Geofence, bool) {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	fence, ok := g.fences[fenceID]
+	return fence, ok
+}
+
+func (g *geofenceTracker) list() []ds.Geofence {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	fences := make([]ds.Geofence, 0, len(g.fences))
+	for _, fence := range g.fences {
+		fences = append(fences, fence)
+	}
+	sort.Slice(fences, func(i, j int) bool {
+		return fences[i].ID < fences[j].ID
+	})
+	return fences
+}
+
+// track evaluates all geofences against the new position of a location and records the resulting events
+func (g *geofenceTracker) track(e logEntry, locationID string, position ds.Position) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for fenceID, fence := range g.fences {
+		membership, wasInside := g.membership[locationID][fenceID]
+		isInside := fence.Contains(position, g.distance)
+		switch {
+		case isInside && !wasInside:
+			g.addMembership(locationID, fenceID, e.timestamp)
+			g.addEvent(e, GeofenceEnter, fenceID, locationID, position)
+		case !isInside && wasInside:
+			g.removeMembership(locationID, fenceID)
+			g.addEvent(e, GeofenceExit, fenceID, locationID, position)
+		case isInside && fence.DwellTime > 0 && !membership.Dwelled &&
+			e.timestamp-membership.EnteredAt >= int64(fence.DwellTime)*1000:
+			membership.Dwelled = true
+			g.addEvent(e, GeofenceDwell, fenceID, locationID, position)
+		}
+	}
+}
+
+// untrack produces exit events for a deleted location from all the geofences it was in
+func (g *geofenceTracker) untrack(e logEntry, locationID string, lastPosition ds.Position) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	for fenceID := range g.membership[locationID] {
+		g.addEvent(e, GeofenceExit, fenceID, locationID, lastPosition)
+	}
+	delete(g.membership, locationID)
+}
+
+func (g *geofenceTracker) addMembership(locationID, fenceID string, enteredAt int64) {
+	if _, ok := g.membership[locationID]; !ok {
+		g.membership[locationID] = map[string]*geofenceMembership{}
+	}
+	g.membership[locationID][fenceID] = &geofenceMembership{EnteredAt: enteredAt}
+}
+
+func (g *geofenceTracker) removeMembership(locationID, fenceID string) {
+	delete(g.membership[locationID], fenceID)
+	if len(g.membership[locationID]) == 0 {
+		delete(g.membership, locationID)
+	}
+}
+
+func (g *geofenceTracker) addEvent(e logEntry, eventType GeofenceEventType, fenceID, locationID string, position ds.Position) {
+	g.lastSeq++
+	g.events = append(g.events, GeofenceEvent{
+		Seq:        g.lastSeq,
+		Index:      e.index,
+		Type:       eventType,
+		GeofenceID: fenceID,
+		LocationID: locationID,
+		Lat:        position.Lat(),
+		Long:       position.Long(),
+		Timestamp:  e.timestamp,
+	})
+	//Re-slices rather than copies the retained events, compacting them only once the array exceeds twice the buffer
+	if overflow := len(g.events) - geofenceEventBufferSize; overflow > 0 {
+		g.events = g.events[overflow:]
+	}
+	if cap(g.events) > 2*geofenceEventBufferSize {
+		g.events = append(make([]GeofenceEvent, 0, 2*geofenceEventBufferSize), g.events...)
+	}
+}
+
+// eventsSince returns up to limit events with a Seq greater than since, oldest first
+func (g *geofenceTracker) eventsSince(since uint64, limit int) []GeofenceEvent {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	start := sort.Search(len(g.events), func(i int) bool {
+		return g.events[i].Seq > since
+	})
+	end := len(g.events)
+	if end-start > limit {
+		end = start + limit
+	}
+	return append([]GeofenceEvent{}, g.events[start:end]...)
+}
+
+func (g *geofenceTracker) state() geofenceState {
+	g.mtx.RLock()
+	defer g.mtx.RUnlock()
+	state := geofenceState{
+		Geofences:  make(map[string]ds.Geofence, len(g.fences)),
+		Membership: make(map[string]map[string]*geofenceMembership, len(g.membership)),
+	}
+	for fenceID, fence := range g.fences {
+		state.Geofences[fenceID] = fence
+	}
+	for locationID, fences := range g.membership {
+		state.Membership[locationID] = map[string]*geofenceMembership{}
+		for fenceID, membership := range fences {
+			membershipCopy := *membership
+			state.Membership[locationID][fenceID] = &membershipCopy
+		}
+	}
+	return state
+}
+
+// restore replaces the geofences and memberships while retaining the node local event history
+func (g *geofenceTracker) restore(state geofenceState) {
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.fences = map[string]ds.Geofence{}
+	for fenceID, fence := range state.Geofences {
+		g.fences[fenceID] = fence
+	}
+	g.membership = map[string]map[string]*geofenceMembership{}
+	for locationID, fences := range state.Membership {
+		for fenceID, membership := range fences {
+			g.addMembership(locationID, fenceID, membership.EnteredAt)
+			g.membership[locationID][fenceID].Dwelled = membership.Dwelled
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hashicorp/raft"
+	"github.com/quadrille/quadrille/core/ds"
+	"io/ioutil"
+	"testing"
+)
+
+func applyCommands(t *testing.T, f *fsm, index uint64, commands ...Command) {
+	b, err := json.Marshal(commands)
+	if err != nil {
+		t.Fatalf("Failed to marshal commands: %s", err.Error())
+	}
+	f.Apply(&raft.Log{Index: index, Data: b})
+}
+
+func TestGeofenceEvents(t *testing.T) {
+	f := (*fsm)(New("", "").(*store))
+	fence := ds.NewCircularGeofence("airport", *ds.NewPosition(13.1986, 77.7066), 1000)
+	fence.DwellTime = 60
+
+	applyCommands(t, f, 1, Command{Op: string(OperationInsert), LocationID: "parked", Lat: 13.1990, Long: 77.7070, Timestamp: 1000})
+	applyCommands(t, f, 2, Command{Op: string(OperationSetGeofence), Geofence: fence, Timestamp: 2000})
+	applyCommands(t, f, 3, Command{Op: string(OperationInsert), LocationID: "cab", Lat: 13.0, Long: 77.5, Timestamp: 3000})
+	applyCommands(t, f, 4, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.1980, Long: 77.7060, Timestamp: 4000})
+	applyCommands(t, f, 5, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.1981, Long: 77.7061, Timestamp: 70000})
+	applyCommands(t, f, 6, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.0, Long: 77.5, Timestamp: 80000})
+	applyCommands(t, f, 7, Command{Op: string(OperationDelete), LocationID: "parked", Timestamp: 90000})
+
+	expected := []struct {
+		eventType  GeofenceEventType
+		locationID string
+		index      uint64
+	}{
+		{GeofenceEnter, "cab", 4},
+		{GeofenceDwell, "cab", 5},
+		{GeofenceExit, "cab", 6},
+		{GeofenceExit, "parked", 7},
+	}
+	events := f.geofences.eventsSince(0, 100)
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %v", len(expected), events)
+	}
+	for i, event := range events {
+		if event.Type != expected[i].eventType || event.LocationID != expected[i].locationID || event.Index != expected[i].index {
+			t.Fatalf("Expected event %d to be %v, got %v", i, expected[i], event)
+		}
+	}
+	if events = f.geofences.eventsSince(events[1].Seq, 1); len(events) != 1 || events[0].Type != GeofenceExit {
+		t.Fatalf("Expected the exit event after the dwell event, got %v", events)
+	}
+
+	//Invalid geofences are rejected however the command reaches the log
+	applyCommands(t, f, 8, Command{Op: string(OperationSetGeofence), Geofence: ds.NewCircularGeofence("lake", *ds.NewPosition(12.97, 77.59), -1), Timestamp: 100000})
+	if _, ok := f.geofences.get("lake"); ok {
+		t.Fatalf("Expected the geofence with a negative radius to be rejected")
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	f := (*fsm)(New("", "").(*store))
+	applyCommands(t, f, 1,
+		Command{Op: string(OperationInsert), LocationID: "cab", Lat: 13.1980, Long: 77.7060, Timestamp: 1000},
+		Command{Op: string(OperationSetGeofence), Geofence: ds.NewCircularGeofence("airport", *ds.NewPosition(13.1986, 77.7066), 1000), Timestamp: 1000})
+
+	snapshot, _ := f.Snapshot()
+	b, err := json.Marshal(snapshot.(*fsmSnapshot).state)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %s", err.Error())
+	}
+	restored := (*fsm)(New("", "").(*store))
+	if err := restored.Restore(ioutil.NopCloser(bytes.NewReader(b))); err != nil {
+		t.Fatalf("Expected no error, got %s", err.Error())
+	}
+	if _, err := restored.q.Get("cab"); err != nil {
+		t.Fatalf("Expected cab to be restored, got %s", err.Error())
+	}
+	if _, ok := restored.geofences.get("airport"); !ok {
+		t.Fatalf("Expected airport geofence to be restored")
+	}
+	if _, ok := restored.geofences.membership["cab"]["airport"]; !ok {
+		t.Fatalf("Expected cab to be restored inside airport geofence")
+	}
+
+	legacy := []byte(`{"version":{"location":{"Latitude":1,"Longitude":2},"locationID":"version","data":{}}}`)
+	if err := restored.Restore(ioutil.NopCloser(bytes.NewReader(legacy))); err != nil {
+		t.Fatalf("Expected no error restoring unversioned snapshot, got %s", err.Error())
+	}
+	if leaf, err := restored.q.Get("version"); err != nil || leaf.GetLocation().Long() != 2 {
+		t.Fatalf("Expected location version to be restored from unversioned snapshot, got %v, %v", leaf, err)
+	}
+}
+
+func TestGeofenceEventsRetained(t *testing.T) {
+	g := newGeofenceTracker(ds.Haversine)
+	for i := uint64(1); i <= 3*geofenceEventBufferSize; i++ {
+		g.addEvent(logEntry{index: i}, GeofenceEnter, "fence-1", "cab-1", *ds.NewPosition(12.97, 77.59))
+		if cap(g.events) > 2*geofenceEventBufferSize {
+			t.Fatalf("Expected at most %d events to be held onto, got %d", 2*geofenceEventBufferSize, cap(g.events))
+		}
+	}
+	if events := g.eventsSince(0, 3*geofenceEventBufferSize); len(events) != geofenceEventBufferSize || events[0].Seq != 2*geofenceEventBufferSize+1 {
+		t.Fatalf("Expected the %d most recent events, got %d from seq %d", geofenceEventBufferSize, len(events), events[0].Seq)
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"github.com/quadrille/quadrille/core/ds"
+	"sort"
+	"sync"
+)
+
+//Maximum number of positions retained per location
+const maxHistorySize = 10000
+
+//TrajectoryPoint is a position of a location along with the time at which it was written
+type TrajectoryPoint struct {
+	Lat       float64 `json:"lat"`
+	Long      float64 `json:"lon"`
+	Alt       float64 `json:"alt,omitempty"`
+	Timestamp int64   `json:"ts"` //Unix time in milliseconds
+}
+
+//Trajectory is the path taken by a location, along with the distance travelled in metres along it
+type Trajectory struct {
+	LocationID string            `json:"location_id"`
+	Points     []TrajectoryPoint `json:"points"`
+	Distance   float64           `json:"distance"`
+}
+
+type historyEntry struct {
+	Size   int               `json:"size"`
+	Points []TrajectoryPoint `json:"points"`
+}
+
+//historyTracker holds the recent positions of the locations which have opted into history
+type historyTracker struct {
+	mtx      sync.RWMutex
+	entries  map[string]*historyEntry
+	distance ds.DistanceModel //Measures the distance travelled along a trajectory
+}
+
+func newHistoryTracker(distance ds.DistanceModel) *historyTracker {
+	return &historyTracker{entries: map[string]*historyEntry{}, distance: distance}
+}
+
+//enable retains up to size positions of the location, starting with its current position.
+//A size of 0 disables and discards the history of the location.
+func (h *historyTracker) enable(locationID string, size int, position ds.GeoLocation, timestamp int64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if size <= 0 {
+		delete(h.entries, locationID)
+		return
+	}
+	entry, ok := h.entries[locationID]
+	if !ok {
+		entry = &historyEntry{}
+		h.entries[locationID] = entry
+		entry.Points = append(entry.Points, TrajectoryPoint{Lat: position.Lat(), Long: position.Long(), Alt: position.Alt(), Timestamp: timestamp})
+	}
+	entry.Size = size
+	entry.trim()
+}
+
+//record appends the position to the history of the location if it has opted in
+func (h *historyTracker) record(locationID string, position ds.GeoLocation, timestamp int64) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	entry, ok := h.entries[locationID]
+	if !ok {
+		return
+	}
+	entry.Points = append(entry.Points, TrajectoryPoint{Lat: position.Lat(), Long: position.Long(), Alt: position.Alt(), Timestamp: timestamp})
+	entry.trim()
+}
+
+func (h *historyTracker) remove(locationID string) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	delete(h.entries, locationID)
+}
+
+//trajectory returns the positions of the location written between from and to, both inclusive.
+//A to of 0 leaves the range open ended.
+func (h *historyTracker) trajectory(locationID string, from, to int64) (Trajectory, bool) {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	entry, ok := h.entries[locationID]
+	if !ok {
+		return Trajectory{}, false
+	}
+	start := sort.Search(len(entry.Points), func(i int) bool { return entry.Points[i].Timestamp >= from })
+	end := len(entry.Points)
+	if to > 0 {
+		end = sort.Search(len(entry.Points), func(i int) bool { return entry.Points[i].Timestamp > to })
+	}
+	t := Trajectory{LocationID: locationID, Points: []TrajectoryPoint{}}
+	if start < end {
+		t.Points = append(t.Points, entry.Points[start:end]...)
+	}
+	for i := 1; i < len(t.Points); i++ {
+		prev, cur := t.Points[i-1], t.Points[i]
+		t.Distance += h.distance.Distance(ds.NewPosition(prev.Lat, prev.Long), ds.NewPosition(cur.Lat, cur.Long))
+	}
+	return t, true
+}
+
+func (h *historyTracker) state() map[string]historyEntry {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	state := make(map[string]historyEntry, len(h.entries))
+	for locationID, entry := range h.entries {
+		state[locationID] = historyEntry{Size: entry.Size, Points: append([]TrajectoryPoint{}, entry.Points...)}
+	}
+	return state
+}
+
+func (h *historyTracker) restore(state map[string]historyEntry) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.entries = make(map[string]*historyEntry, len(state))
+	for locationID, entry := range state {
+		entry := entry
+		h.entries[locationID] = &entry
+	}
+}
+
+//Drops the oldest positions beyond the retained size by re-slicing, so a recorded position costs O(1) on average.
+//The positions are only copied into a new array once the one they hold onto exceeds twice the size, as after append
+//grows it or the size is reduced, so that the dropped positions are released.
+func (e *historyEntry) trim() {
+	if overflow := len(e.Points) - e.Size; overflow > 0 {
+		e.Points = e.Points[overflow:]
+	}
+	if cap(e.Points) > 2*e.Size {
+		e.Points = append(make([]TrajectoryPoint, 0, 2*e.Size), e.Points...)
+	}
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTrajectory(t *testing.T) {
+	f := (*fsm)(New("", "").(*store))
+	applyCommands(t, f, 1, Command{Op: string(OperationInsert), LocationID: "cab", Lat: 13.0, Long: 77.5, Timestamp: 1000})
+	applyCommands(t, f, 2, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.1, Long: 77.5, Timestamp: 2000})
+	if _, ok := f.history.trajectory("cab", 0, 0); ok {
+		t.Fatalf("Expected no history before opting in")
+	}
+	//Sizes beyond the limit are rejected however the command reaches the log
+	applyCommands(t, f, 3, Command{Op: string(OperationSetHistory), LocationID: "cab", HistorySize: maxHistorySize + 1, Timestamp: 2500})
+	if _, ok := f.history.trajectory("cab", 0, 0); ok {
+		t.Fatalf("Expected no history for a size beyond %d", maxHistorySize)
+	}
+
+	applyCommands(t, f, 4, Command{Op: string(OperationSetHistory), LocationID: "cab", HistorySize: 3, Timestamp: 3000})
+	applyCommands(t, f, 5, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.2, Long: 77.5, Timestamp: 4000})
+	applyCommands(t, f, 6, Command{Op: string(OperationUpdateLocation), LocationID: "cab", Lat: 13.3, Long: 77.5, Timestamp: 5000})
+	applyCommands(t, f, 7, Command{Op: string(OperationUpdate), LocationID: "cab", Lat: 13.4, Long: 77.5, Timestamp: 6000})
+
+	trajectory, ok := f.history.trajectory("cab", 0, 0)
+	if !ok || len(trajectory.Points) != 3 || trajectory.Points[0].Timestamp != 4000 || trajectory.Points[2].Lat != 13.4 {
+		t.Fatalf("Expected the 3 most recent positions, got %v", trajectory.Points)
+	}
+	//0.1 degree of latitude is ~11.1km
+	if math.Abs(trajectory.Distance-22239) > 10 {
+		t.Fatalf("Expected ~22239m travelled, got %f", trajectory.Distance)
+	}
+
+	trajectory, _ = f.history.trajectory("cab", 4500, 5000)
+	if len(trajectory.Points) != 1 || trajectory.Points[0].Lat != 13.3 || trajectory.Distance != 0 {
+		t.Fatalf("Expected the position at 5000, got %v", trajectory)
+	}
+
+	applyCommands(t, f, 8, Command{Op: string(OperationDelete), LocationID: "cab", Timestamp: 7000})
+	if _, ok := f.history.trajectory("cab", 0, 0); ok {
+		t.Fatalf("Expected history to be discarded with the location")
+	}
+}
+
+func TestHistoryEntryTrim(t *testing.T) {
+	entry := historyEntry{Size: 3}
+	for i := int64(1); i <= 1000; i++ {
+		entry.Points = append(entry.Points, TrajectoryPoint{Timestamp: i})
+		entry.trim()
+		if cap(entry.Points) > 2*entry.Size {
+			t.Fatalf("Expected at most %d points to be held onto, got %d", 2*entry.Size, cap(entry.Points))
+		}
+	}
+	if len(entry.Points) != 3 || entry.Points[0].Timestamp != 998 || entry.Points[2].Timestamp != 1000 {
+		t.Fatalf("Expected the 3 most recent positions, got %v", entry.Points)
+	}
+}
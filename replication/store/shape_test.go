@@ -0,0 +1,55 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/quadrille/quadrille/core/ds"
+	"io/ioutil"
+	"testing"
+)
+
+func TestShapes(t *testing.T) {
+	f := (*fsm)(New("", "").(*store))
+	zone := ds.NewPolygonShape("zone", []ds.Polygon{*ds.NewPolygon([]ds.Position{*ds.NewPosition(12.9, 77.5), *ds.NewPosition(13.0, 77.5), *ds.NewPosition(13.0, 77.6), *ds.NewPosition(12.9, 77.6)})}, map[string]interface{}{"surge": 1.5})
+	road := ds.NewLineShape("road", []ds.Position{*ds.NewPosition(12.8, 77.7), *ds.NewPosition(12.8, 77.8)}, nil)
+	applyCommands(t, f, 1,
+		Command{Op: string(OperationSetShape), Shape: zone, Timestamp: 1000},
+		Command{Op: string(OperationSetShape), Shape: road, Timestamp: 1000})
+
+	nearby := f.q.GetShapesNearby(*ds.NewPosition(12.95, 77.55), 100, 10)
+	if len(nearby) != 1 || nearby[0].Shape.ID != "zone" || nearby[0].Distance != 0 || nearby[0].Shape.Data["surge"] != 1.5 {
+		t.Fatalf("Expected the point to lie within zone, got %v", nearby)
+	}
+	if containing := f.q.GetShapesContaining(*ds.NewPosition(12.95, 77.55)); len(containing) != 1 || containing[0].ID != "zone" {
+		t.Fatalf("Expected the point to lie within zone, got %v", containing)
+	}
+	//About 1.1km north of the road
+	nearby = f.q.GetShapesNearby(*ds.NewPosition(12.81, 77.75), 1500, 10)
+	if len(nearby) != 1 || nearby[0].Shape.ID != "road" || nearby[0].Distance < 1000 || nearby[0].Distance > 1200 {
+		t.Fatalf("Expected the road within 1500m, got %v", nearby)
+	}
+
+	snapshot, _ := f.Snapshot()
+	b, err := json.Marshal(snapshot.(*fsmSnapshot).state)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %s", err.Error())
+	}
+	restored := (*fsm)(New("", "").(*store))
+	if err := restored.Restore(ioutil.NopCloser(bytes.NewReader(b))); err != nil {
+		t.Fatalf("Expected no error, got %s", err.Error())
+	}
+	if shape, err := restored.q.GetShape("road"); err != nil || len(shape.Line) != 2 || shape.UpdatedAt != 1000 {
+		t.Fatalf("Expected road to be restored, got %v, %v", shape, err)
+	}
+
+	applyCommands(t, f, 2, Command{Op: string(OperationDeleteShape), ShapeID: "zone", Timestamp: 2000})
+	if nearby = f.q.GetShapesNearby(*ds.NewPosition(12.95, 77.55), 100, 10); len(nearby) != 0 {
+		t.Fatalf("Expected zone to be deleted, got %v", nearby)
+	}
+
+	//Invalid shapes are rejected however the command reaches the log
+	applyCommands(t, f, 3, Command{Op: string(OperationSetShape), Shape: ds.NewLineShape("path", []ds.Position{*ds.NewPosition(12.8, 77.7)}, nil), Timestamp: 3000})
+	if _, err := f.q.GetShape("path"); err == nil {
+		t.Fatalf("Expected the line of a single position to be rejected")
+	}
+}
@@ -6,16 +6,20 @@ import (
 	raftBadger "github.com/bbva/raft-badger"
 	"github.com/hashicorp/raft"
 	"github.com/quadrille/quadrille/core/ds"
+	quadrilleError "github.com/quadrille/quadrille/core/errors"
 	"github.com/quadrille/quadrille/tcp/utils"
 	"io"
+	"io/ioutil"
 	"log"
+	"math"
 	"net"
 	"os"
 	"sort"
 	"time"
 )
 
-const quadTreeHeight = 16
+//Depth below which nodes of the quadtree are not split, however many locations they hold
+const quadTreeMaxDepth = 16
 
 type OperationType string
 
@@ -25,6 +29,12 @@ const (
 	OperationUpdate         OperationType = "update"
 	OperationUpdateLocation OperationType = "updateloc"
 	OperationUpdateData     OperationType = "updatedata"
+	OperationSetGeofence    OperationType = "setgeofence"
+	OperationDeleteGeofence OperationType = "delgeofence"
+	OperationExpire         OperationType = "expire"
+	OperationSetHistory     OperationType = "sethistory"
+	OperationSetShape       OperationType = "setshape"
+	OperationDeleteShape    OperationType = "delshape"
 )
 
 const (
@@ -33,11 +43,20 @@ const (
 )
 
 type Command struct {
-	Op         string                 `json:"op,omitempty"`
-	LocationID string                 `json:"location_id,omitempty"`
-	Lat        float64                `json:"lat,omitempty"`
-	Long       float64                `json:"lon,omitempty"`
-	Data       map[string]interface{} `json:"data,omitempty"`
+	Op          string                 `json:"op,omitempty"`
+	LocationID  string                 `json:"location_id,omitempty"`
+	Lat         float64                `json:"lat,omitempty"`
+	Long        float64                `json:"lon,omitempty"`
+	Alt         float64                `json:"alt,omitempty"` //Metres above sea level, 0 for locations without an altitude
+	Data        map[string]interface{} `json:"data,omitempty"`
+	TTL         int                    `json:"ttl,omitempty"`          //Seconds after which the location is deleted, 0 for no expiry
+	RefreshTTL  bool                   `json:"refresh_ttl,omitempty"`  //Restarts the TTL of the location on updateloc
+	HistorySize int                    `json:"history_size,omitempty"` //Number of positions of the location to retain, 0 to disable history
+	Geofence    *ds.Geofence           `json:"geofence,omitempty"`
+	GeofenceID  string                 `json:"geofence_id,omitempty"`
+	Shape       *ds.Shape              `json:"shape,omitempty"`
+	ShapeID     string                 `json:"shape_id,omitempty"`
+	Timestamp   int64                  `json:"ts,omitempty"` //Unix time in milliseconds at which the leader accepted the command
 }
 
 // Store is the interface Raft-backed key-value stores must implement.
@@ -46,11 +65,14 @@ type Store interface {
 
 	Get(key string) (ds.QuadTreeLeaf, error)
 
-	Insert(locationID string, position ds.GeoLocation, data map[string]interface{}) error
+	// Insert adds a location which is deleted after ttl seconds, or never if ttl is 0.
+	Insert(locationID string, position ds.GeoLocation, data map[string]interface{}, ttl int) error
 
-	Update(locationID string, position ds.GeoLocation, data map[string]interface{}) error
+	// Update replaces a location. A ttl of 0 retains the existing expiry of the location.
+	Update(locationID string, position ds.GeoLocation, data map[string]interface{}, ttl int) error
 
-	UpdateLocation(locationID string, position ds.GeoLocation) error
+	// UpdateLocation moves a location, restarting its TTL if refreshTTL is set.
+	UpdateLocation(locationID string, position ds.GeoLocation, refreshTTL bool) error
 
 	UpdateData(locationID string, data map[string]interface{}) error
 
@@ -58,32 +80,76 @@ type Store interface {
 
 	BulkWrite(commands []Command) error
 
+	SetGeofence(fence ds.Geofence) error
+	DeleteGeofence(id string) error
+	GetGeofence(id string) (ds.Geofence, error)
+	GetGeofences() []ds.Geofence
+	// GetGeofenceEvents returns up to limit geofence events observed by this node after the sequence number since.
+	GetGeofenceEvents(since uint64, limit int) []GeofenceEvent
+
+	// SetHistory retains up to size of the most recent positions of the location, or discards its history if size is 0.
+	SetHistory(locationID string, size int) error
+	// GetTrajectory returns the positions of the location written between from and to, in unix milliseconds.
+	GetTrajectory(locationID string, from, to int64) (Trajectory, error)
+
+	// Watch streams the commands applied to this node, see WatchOptions.
+	Watch(options WatchOptions) (*Watcher, error)
+
 	// Join joins the node, identitifed by nodeID and reachable at addr, to the cluster.
 	Join(nodeID string, addr string) error
 	GetLeader() raft.ServerAddress
-	GetNeighbors(ds.Position, int, int) []ds.QuadTreeNeighborResult
+	GetNeighbors(ds.Position, int, int, ds.Filter, int, ds.AltitudeQuery) []ds.QuadTreeNeighborResult
+	GetLocationsInBox(ds.Position, ds.Position, int, int) []ds.QuadTreeNeighborResult
+	GetLocationsInPolygon([]ds.Polygon, int) []ds.QuadTreeNeighborResult
+	CountNeighbors(ds.Position, int, ds.Filter, int, ds.AltitudeQuery, int) int
+	CountLocationsInBox(ds.Position, ds.Position, int, int) int
+	CountLocationsInPolygon([]ds.Polygon, int) int
+	GetLocationsInGeohash(string, int) ([]ds.QuadTreeNeighborResult, error)
+	GetLocationsAlongRoute([]ds.Position, int, int) []ds.CorridorResult
+	DistanceMatrix([]ds.MatrixPoint, []ds.MatrixPoint) ([][]float64, error)
+	SetShape(ds.Shape) error
+	DeleteShape(string) error
+	GetShape(string) (ds.Shape, error)
+	GetShapesNearby(ds.Position, int, int) []ds.ShapeResult
+	GetShapesContaining(ds.Position) []ds.Shape
+	GetNearest(ds.Position, int, int) []ds.QuadTreeNeighborResult
+	Aggregate(ds.Position, ds.Position, int, string) []ds.GridCell
+	GetClusters(ds.Position, ds.Position, int, int) []ds.Cluster
+	Stats() ds.TreeStats
+	IsPlanar() bool
 	Remove(nodeId string) error
 	Nodes() ([]*Server, error)
 	IsLeader() bool
 }
 
 type store struct {
-	raftDir  string
-	raftBind string
+	raftDir     string
+	raftBind    string
+	treeOptions []ds.QuadTreeOption //Options of the quadtree, also applied to the one restored from a snapshot
 
-	q ds.Quadrille // The core data structure for Quadrille. As it is concurrency-safe, it is not required to synchronize the operations
+	q         ds.Quadrille // The core data structure for Quadrille. As it is concurrency-safe, it is not required to synchronize the operations
+	geofences *geofenceTracker
+	watchers  *watchHub
+	expiry    *expiryTracker
+	history   *historyTracker
 
 	raft   *raft.Raft // The consensus mechanism
 	logger *log.Logger
 }
 
 // New returns a new Store.
-func New(raftDir, raftBind string) Store {
+func New(raftDir, raftBind string, treeOptions ...ds.QuadTreeOption) Store {
+	q := ds.NewQuadTree(quadTreeMaxDepth, treeOptions...)
 	return &store{
-		q:        ds.NewQuadTree(quadTreeHeight),
-		logger:   log.New(os.Stderr, "[store] ", log.LstdFlags),
-		raftDir:  raftDir,
-		raftBind: raftBind,
+		q:           q,
+		geofences:   newGeofenceTracker(q.DistanceModel()),
+		watchers:    newWatchHub(),
+		expiry:      newExpiryTracker(),
+		history:     newHistoryTracker(q.DistanceModel()),
+		logger:      log.New(os.Stderr, "[store] ", log.LstdFlags),
+		raftDir:     raftDir,
+		raftBind:    raftBind,
+		treeOptions: treeOptions,
 	}
 }
 
@@ -137,21 +203,110 @@ func (s *store) Open(enableSingle bool, localID string) error {
 		ra.BootstrapCluster(configuration)
 	}
 
+	go s.expireLocations()
 	return nil
 }
 
+//Periodically deletes the expired locations while this node is the leader.
+//The deletions are replicated through Raft so that every node converges.
+func (s *store) expireLocations() {
+	ticker := time.NewTicker(expiryCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if s.raft.State() != raft.Leader {
+			continue
+		}
+		now := time.Now().UnixNano() / int64(time.Millisecond)
+		expired := s.expiry.expired(now, expiryBatchSize)
+		if len(expired) == 0 {
+			continue
+		}
+		commands := make([]Command, 0, len(expired))
+		for _, locationID := range expired {
+			commands = append(commands, Command{Op: string(OperationExpire), LocationID: locationID, Timestamp: now})
+		}
+		if err := s.replicate(commands); err != nil {
+			s.logger.Printf("failed to expire locations: %s", err.Error())
+		}
+	}
+}
+
 // Get returns the data for the given location_id.
 func (s *store) Get(locationID string) (ds.QuadTreeLeaf, error) {
 	return s.q.Get(locationID)
 }
 
-//Returns nearby locations.
-func (s *store) GetNeighbors(position ds.Position, radius, limit int) []ds.QuadTreeNeighborResult {
-	return s.q.GetNearbyLocations(position, radius, limit)
+//Returns nearby locations written within the last maxAge seconds, or any time if maxAge is 0.
+func (s *store) GetNeighbors(position ds.Position, radius, limit int, filter ds.Filter, maxAge int, altitude ds.AltitudeQuery) []ds.QuadTreeNeighborResult {
+	return s.q.GetNearbyLocationsWithAltitude(position, radius, limit, filter, minUpdatedAt(maxAge), altitude)
+}
+
+//Returns locations within the box formed by the sw and ne corners written within the last maxAge seconds.
+func (s *store) GetLocationsInBox(sw, ne ds.Position, limit int, maxAge int) []ds.QuadTreeNeighborResult {
+	return s.q.GetLocationsInBox(sw, ne, limit, minUpdatedAt(maxAge))
+}
+
+//Counts the locations GetNeighbors would return without a limit, up to limit of them, or all of them if limit is 0.
+func (s *store) CountNeighbors(position ds.Position, radius int, filter ds.Filter, maxAge int, altitude ds.AltitudeQuery, limit int) int {
+	return s.q.CountNearbyLocations(position, radius, filter, minUpdatedAt(maxAge), altitude, limit)
+}
+
+//Counts the locations GetLocationsInBox would return without a limit, up to limit of them, or all of them if limit is 0.
+func (s *store) CountLocationsInBox(sw, ne ds.Position, maxAge, limit int) int {
+	return s.q.CountLocationsInBox(sw, ne, minUpdatedAt(maxAge), limit)
+}
+
+//Returns the count of locations, and the sum and average of field if given, per node at depth within the box.
+func (s *store) Aggregate(sw, ne ds.Position, depth int, field string) []ds.GridCell {
+	return s.q.Aggregate(sw, ne, depth, field)
+}
+
+//Returns the clusters of locations for the viewport at the map zoom level, each with up to sampleSize location ids.
+func (s *store) GetClusters(sw, ne ds.Position, zoom, sampleSize int) []ds.Cluster {
+	return s.q.GetClusters(sw, ne, zoom, sampleSize)
+}
+
+//Converts a maximum age in seconds to the earliest acceptable write time in unix milliseconds.
+//Ages are measured against the local clock whereas write times are the leader's clock.
+func minUpdatedAt(maxAge int) int64 {
+	if maxAge <= 0 {
+		return 0
+	}
+	return time.Now().UnixNano()/int64(time.Millisecond) - int64(maxAge)*1000
+}
+
+//Returns locations within any of the given polygons.
+func (s *store) GetLocationsInPolygon(polygons []ds.Polygon, limit int) []ds.QuadTreeNeighborResult {
+	return s.q.GetLocationsInPolygon(polygons, limit)
+}
+
+//Counts the locations within any of the given polygons, up to limit of them, or all of them if limit is 0.
+func (s *store) CountLocationsInPolygon(polygons []ds.Polygon, limit int) int {
+	return s.q.CountLocationsInPolygon(polygons, limit)
+}
+
+//Returns locations whose geohash starts with the given geohash.
+func (s *store) GetLocationsInGeohash(geohash string, limit int) ([]ds.QuadTreeNeighborResult, error) {
+	return s.q.GetLocationsInGeohash(geohash, limit)
+}
+
+//Returns locations within buffer metres of the route, ordered by their distance along it.
+func (s *store) GetLocationsAlongRoute(route []ds.Position, buffer, limit int) []ds.CorridorResult {
+	return s.q.GetLocationsAlongRoute(route, buffer, limit)
+}
+
+//Returns the distance from each origin to each destination, with a row per origin.
+func (s *store) DistanceMatrix(origins, destinations []ds.MatrixPoint) ([][]float64, error) {
+	return s.q.DistanceMatrix(origins, destinations)
+}
+
+//Returns the k nearest locations, optionally capped to maxDistance metres.
+func (s *store) GetNearest(position ds.Position, k, maxDistance int) []ds.QuadTreeNeighborResult {
+	return s.q.GetNearestLocations(position, k, maxDistance)
 }
 
 // Set sets the data for the given location_id.
-func (s *store) Insert(locationID string, location ds.GeoLocation, data map[string]interface{}) error {
+func (s *store) Insert(locationID string, location ds.GeoLocation, data map[string]interface{}, ttl int) error {
 	if s.raft.State() != raft.Leader {
 		return ErrNonLeaderNode
 	}
@@ -161,18 +316,14 @@ func (s *store) Insert(locationID string, location ds.GeoLocation, data map[stri
 		LocationID: locationID,
 		Lat:        location.Lat(),
 		Long:       location.Long(),
+		Alt:        location.Alt(),
 		Data:       data,
+		TTL:        ttl,
 	}}
-	b, err := json.Marshal(c)
-	if err != nil {
-		return err
-	}
-
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(c)
 }
 
-func (s *store) Update(locationID string, location ds.GeoLocation, data map[string]interface{}) error {
+func (s *store) Update(locationID string, location ds.GeoLocation, data map[string]interface{}, ttl int) error {
 	if s.raft.State() != raft.Leader {
 		return ErrNonLeaderNode
 	}
@@ -181,18 +332,14 @@ func (s *store) Update(locationID string, location ds.GeoLocation, data map[stri
 		LocationID: locationID,
 		Lat:        location.Lat(),
 		Long:       location.Long(),
+		Alt:        location.Alt(),
 		Data:       data,
+		TTL:        ttl,
 	}}
-	b, err := json.Marshal(c)
-	if err != nil {
-		return err
-	}
-
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(c)
 }
 
-func (s *store) UpdateLocation(locationID string, location ds.GeoLocation) error {
+func (s *store) UpdateLocation(locationID string, location ds.GeoLocation, refreshTTL bool) error {
 	if s.raft.State() != raft.Leader {
 		return ErrNonLeaderNode
 	}
@@ -202,14 +349,10 @@ func (s *store) UpdateLocation(locationID string, location ds.GeoLocation) error
 		LocationID: locationID,
 		Lat:        location.Lat(),
 		Long:       location.Long(),
+		Alt:        location.Alt(),
+		RefreshTTL: refreshTTL,
 	}}
-	b, err := json.Marshal(c)
-	if err != nil {
-		return err
-	}
-
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(c)
 }
 
 func (s *store) UpdateData(locationID string, data map[string]interface{}) error {
@@ -222,13 +365,7 @@ func (s *store) UpdateData(locationID string, data map[string]interface{}) error
 		LocationID: locationID,
 		Data:       data,
 	}}
-	b, err := json.Marshal(c)
-	if err != nil {
-		return err
-	}
-
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+	return s.apply(c)
 }
 
 // Delete deletes the given location.
@@ -244,19 +381,160 @@ func (s *store) Delete(locationID string) error {
 		Op:         string(OperationDelete),
 		LocationID: locationID,
 	}}
-	b, err := json.Marshal(c)
-	if err != nil {
+	return s.apply(c)
+}
+
+func (s *store) SetGeofence(fence ds.Geofence) error {
+	if s.raft.State() != raft.Leader {
+		return ErrNonLeaderNode
+	}
+	if err := fence.Validate(); err != nil {
 		return err
 	}
+	c := []Command{Command{
+		Op:       string(OperationSetGeofence),
+		Geofence: &fence,
+	}}
+	return s.apply(c)
+}
+
+func (s *store) DeleteGeofence(id string) error {
+	if s.raft.State() != raft.Leader {
+		return ErrNonLeaderNode
+	}
+	if _, ok := s.geofences.get(id); !ok {
+		return quadrilleError.ErrGeofenceNotFound
+	}
+	c := []Command{Command{
+		Op:         string(OperationDeleteGeofence),
+		GeofenceID: id,
+	}}
+	return s.apply(c)
+}
 
-	f := s.raft.Apply(b, raftTimeout)
-	return f.Error()
+func (s *store) GetGeofence(id string) (ds.Geofence, error) {
+	fence, ok := s.geofences.get(id)
+	if !ok {
+		return ds.Geofence{}, quadrilleError.ErrGeofenceNotFound
+	}
+	return fence, nil
+}
+
+func (s *store) GetGeofences() []ds.Geofence {
+	return s.geofences.list()
+}
+
+func (s *store) GetGeofenceEvents(since uint64, limit int) []GeofenceEvent {
+	return s.geofences.eventsSince(since, limit)
+}
+
+func (s *store) SetShape(shape ds.Shape) error {
+	if s.raft.State() != raft.Leader {
+		return ErrNonLeaderNode
+	}
+	if err := shape.Validate(); err != nil {
+		return err
+	}
+	c := []Command{Command{
+		Op:    string(OperationSetShape),
+		Shape: &shape,
+	}}
+	return s.apply(c)
+}
+
+func (s *store) DeleteShape(id string) error {
+	if s.raft.State() != raft.Leader {
+		return ErrNonLeaderNode
+	}
+	if _, err := s.q.GetShape(id); err != nil {
+		return err
+	}
+	c := []Command{Command{
+		Op:      string(OperationDeleteShape),
+		ShapeID: id,
+	}}
+	return s.apply(c)
+}
+
+func (s *store) GetShape(id string) (ds.Shape, error) {
+	return s.q.GetShape(id)
+}
+
+func (s *store) GetShapesNearby(position ds.Position, radius, limit int) []ds.ShapeResult {
+	return s.q.GetShapesNearby(position, radius, limit)
+}
+
+func (s *store) GetShapesContaining(position ds.Position) []ds.Shape {
+	return s.q.GetShapesContaining(position)
+}
+
+func (s *store) SetHistory(locationID string, size int) error {
+	if s.raft.State() != raft.Leader {
+		return ErrNonLeaderNode
+	}
+	if size < 0 || size > maxHistorySize {
+		return quadrilleError.ErrInvalidHistorySize
+	}
+	if _, err := s.q.Get(locationID); err != nil {
+		return err
+	}
+	c := []Command{Command{
+		Op:          string(OperationSetHistory),
+		LocationID:  locationID,
+		HistorySize: size,
+	}}
+	return s.apply(c)
+}
+
+func (s *store) GetTrajectory(locationID string, from, to int64) (Trajectory, error) {
+	trajectory, ok := s.history.trajectory(locationID, from, to)
+	if !ok {
+		return Trajectory{}, quadrilleError.ErrHistoryNotEnabled
+	}
+	return trajectory, nil
+}
+
+func (s *store) Watch(options WatchOptions) (*Watcher, error) {
+	return s.watchers.subscribe(options)
+}
+
+//Operations a bulk write may carry. The other operations are validated by their own methods or issued by the leader.
+var bulkWriteOperations = map[OperationType]bool{
+	OperationInsert:         true,
+	OperationUpdate:         true,
+	OperationUpdateLocation: true,
+	OperationUpdateData:     true,
+	OperationDelete:         true,
 }
 
 func (s *store) BulkWrite(commands []Command) error {
 	if s.raft.State() != raft.Leader {
 		return ErrNonLeaderNode
 	}
+	for _, c := range commands {
+		if !bulkWriteOperations[OperationType(c.Op)] {
+			return ErrUnsupportedBulkOperation
+		}
+	}
+	return s.apply(commands)
+}
+
+//Stamps the commands with the current time and replicates them through the Raft log.
+//The timestamp is part of the log entry so that every node observes the same time for a write.
+//A timestamp set by the client is overwritten, as expiry, maxAge and history all rely on the time of the leader.
+func (s *store) apply(commands []Command) error {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	for i := range commands {
+		commands[i].Timestamp = now
+	}
+	return s.replicate(commands)
+}
+
+//Replicates commands the leader has already stamped through the Raft log.
+func (s *store) replicate(commands []Command) error {
+	if err := s.checkBounds(commands); err != nil {
+		return err
+	}
 	b, err := json.Marshal(commands)
 	if err != nil {
 		return err
@@ -266,6 +544,31 @@ func (s *store) BulkWrite(commands []Command) error {
 	return f.Error()
 }
 
+//Rejects commands placing a location or a geofence outside the bounds of the tree, as the tree could never hold them
+func (s *store) checkBounds(commands []Command) error {
+	for _, c := range commands {
+		positions := []ds.Position{}
+		switch OperationType(c.Op) {
+		case OperationInsert, OperationUpdate, OperationUpdateLocation:
+			positions = append(positions, *ds.NewPositionWithAltitude(c.Lat, c.Long, c.Alt))
+		case OperationSetGeofence:
+			if c.Geofence != nil {
+				positions = c.Geofence.Positions()
+			}
+		case OperationSetShape:
+			if c.Shape != nil {
+				positions = c.Shape.Positions()
+			}
+		}
+		for _, position := range positions {
+			if !s.q.Contains(position) {
+				return quadrilleError.ErrPositionOutOfBounds
+			}
+		}
+	}
+	return nil
+}
+
 // Join joins a node, identified by nodeID and located at addr, to this store.
 // The node must be ready to respond to Raft communications at that address.
 func (s *store) Join(nodeID, addr string) error {
@@ -336,6 +639,16 @@ func (s *store) remove(id string) error {
 	return nil
 }
 
+//Returns the shape of the quadtree
+func (s *store) Stats() ds.TreeStats {
+	return s.q.Stats()
+}
+
+//Returns whether positions are planar y,x coordinates rather than latitudes and longitudes
+func (s *store) IsPlanar() bool {
+	return s.q.IsPlanar()
+}
+
 // GetLeader returns the address of the cluster leader
 func (s *store) GetLeader() raft.ServerAddress {
 	return s.raft.Leader()
@@ -372,6 +685,12 @@ type fsmGenericResponse struct {
 
 type fsm store
 
+//logEntry identifies the Raft log entry and the time at which a command was accepted by the leader
+type logEntry struct {
+	index     uint64
+	timestamp int64
+}
+
 // Apply applies a Raft log entry to the Quadrille store.
 func (f *fsm) Apply(l *raft.Log) interface{} {
 	var commands []Command
@@ -382,28 +701,73 @@ func (f *fsm) Apply(l *raft.Log) interface{} {
 		return nil
 	}
 	for _, cmd := range commands {
-		f.executeCmd(cmd)
+		e := logEntry{index: l.Index, timestamp: cmd.Timestamp}
+		if e.timestamp == 0 {
+			//Commands written before timestamps were introduced fall back to the local clock
+			e.timestamp = time.Now().UnixNano() / int64(time.Millisecond)
+		}
+		before := f.locationPosition(cmd.LocationID)
+		if err, _ := f.executeCmd(e, cmd).(error); err == nil {
+			f.watchers.publish(newChangeEvent(e, cmd, before, f.locationPosition(cmd.LocationID)))
+		}
 	}
 	return nil
 }
 
-func (f *fsm) executeCmd(c Command) interface{} {
+//Returns the current position of the location, or nil if it does not exist
+func (f *fsm) locationPosition(locationID string) *ds.Position {
+	if locationID == "" {
+		return nil
+	}
+	leaf, err := f.q.Get(locationID)
+	if err != nil {
+		return nil
+	}
+	position := leaf.GetLocation()
+	return &position
+}
+
+func (f *fsm) executeCmd(e logEntry, c Command) interface{} {
 	switch OperationType(c.Op) {
 	case OperationInsert:
-		return f.applyInsert(c.LocationID, *ds.NewPosition(c.Lat, c.Long), c.Data)
+		return f.applyInsert(e, c.LocationID, *ds.NewPositionWithAltitude(c.Lat, c.Long, c.Alt), c.Data, c.TTL)
 	case OperationDelete:
-		return f.applyDelete(c.LocationID)
+		return f.applyDelete(e, c.LocationID)
 	case OperationUpdate:
-		return f.applyUpdate(c.LocationID, *ds.NewPosition(c.Lat, c.Long), c.Data)
+		return f.applyUpdate(e, c.LocationID, *ds.NewPositionWithAltitude(c.Lat, c.Long, c.Alt), c.Data, c.TTL)
 	case OperationUpdateLocation:
-		return f.applyUpdateLocation(c.LocationID, *ds.NewPosition(c.Lat, c.Long))
+		return f.applyUpdateLocation(e, c.LocationID, *ds.NewPositionWithAltitude(c.Lat, c.Long, c.Alt), c.RefreshTTL)
 	case OperationUpdateData:
-		return f.applyUpdateData(c.LocationID, c.Data)
+		return f.applyUpdateData(e, c.LocationID, c.Data)
+	case OperationSetGeofence:
+		return f.applySetGeofence(e, c.Geofence)
+	case OperationDeleteGeofence:
+		return f.applyDeleteGeofence(c.GeofenceID)
+	case OperationExpire:
+		return f.applyExpire(e, c.LocationID)
+	case OperationSetHistory:
+		return f.applySetHistory(e, c.LocationID, c.HistorySize)
+	case OperationSetShape:
+		return f.applySetShape(e, c.Shape)
+	case OperationDeleteShape:
+		return f.applyDeleteShape(c.ShapeID)
 	default:
 		panic(fmt.Sprintf("unrecognized Command op: %s", c.Op))
 	}
 }
 
+//Version of the snapshot format. Snapshots prior to version 2 were a bare map of locations.
+const snapshotVersion = 2
+
+type snapshotState struct {
+	Version   int                        `json:"version"`
+	Locations map[string]ds.QuadTreeLeaf `json:"locations"`
+	Geofences geofenceState              `json:"geofences"`
+	Expiry    map[string]expiryEntry     `json:"expiry,omitempty"`
+	History   map[string]historyEntry    `json:"history,omitempty"`
+	Shapes    []ds.Shape                 `json:"shapes,omitempty"`
+}
+
 // Snapshot returns a snapshot of the Quadrille store.
 func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
 	// Clone the map.
@@ -411,56 +775,179 @@ func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
 	for k, v := range f.q.GetAllLocations() {
 		o[k] = v
 	}
-	return &fsmSnapshot{store: o}, nil
+	return &fsmSnapshot{state: snapshotState{
+		Version:   snapshotVersion,
+		Locations: o,
+		Geofences: f.geofences.state(),
+		Expiry:    f.expiry.state(),
+		History:   f.history.state(),
+		Shapes:    f.q.GetAllShapes(),
+	}}, nil
 }
 
 // Restore stores the Quadrille store to a previous state.
 func (f *fsm) Restore(rc io.ReadCloser) error {
-	o := make(map[string]ds.QuadTreeLeaf)
-	if err := json.NewDecoder(rc).Decode(&o); err != nil {
+	state, err := decodeSnapshot(rc)
+	if err != nil {
 		log.Println(err)
 		return err
 	}
 
 	// Set the state from the snapshot, no lock required according to
 	// Hashicorp docs.
-	qTmp := ds.NewQuadTree(16)
-	for locationID, leaf := range o {
-		qTmp.Insert(locationID, leaf.GetLocation(), leaf.Data)
+	qTmp := ds.NewQuadTree(quadTreeMaxDepth, f.treeOptions...)
+	for locationID, leaf := range state.Locations {
+		qTmp.Insert(locationID, leaf.GetLocation(), leaf.Data, leaf.UpdatedAt)
+	}
+	for _, shape := range state.Shapes {
+		qTmp.SetShape(shape, shape.UpdatedAt)
 	}
 	f.q = qTmp
+	f.geofences.restore(state.Geofences)
+	f.expiry.restore(state.Expiry)
+	f.history.restore(state.History)
+	f.watchers.reset()
+	return nil
+}
+
+//Decodes both the current snapshot format and the bare map of locations used before versioning.
+//A location_id of "version" in an old snapshot maps to an object and hence cannot be mistaken for the version.
+func decodeSnapshot(r io.Reader) (snapshotState, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return snapshotState{}, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return snapshotState{}, err
+	}
+	var state snapshotState
+	var version int
+	if versionRaw, ok := raw["version"]; ok && json.Unmarshal(versionRaw, &version) == nil {
+		err = json.Unmarshal(b, &state)
+		return state, err
+	}
+	state.Locations = make(map[string]ds.QuadTreeLeaf, len(raw))
+	err = json.Unmarshal(b, &state.Locations)
+	return state, err
+}
+
+func (f *fsm) applyInsert(e logEntry, locationId string, location ds.Position, data map[string]interface{}, ttl int) interface{} {
+	f.q.Insert(locationId, location, data, e.timestamp)
+	f.expiry.set(locationId, ttl, e.timestamp)
+	f.history.record(locationId, location, e.timestamp)
+	f.geofences.track(e, locationId, location)
+	return nil
+}
+
+func (f *fsm) applyDelete(e logEntry, key string) error {
+	leaf, err := f.q.Get(key)
+	if err != nil {
+		return err
+	}
+	if err := f.q.Delete(key); err != nil {
+		return err
+	}
+	f.expiry.remove(key)
+	f.history.remove(key)
+	f.geofences.untrack(e, key, leaf.GetLocation())
+	return nil
+}
+
+//applyExpire deletes the location only if it is still expired as of the command's timestamp,
+//as its TTL may have been refreshed after the leader found it to be expired
+func (f *fsm) applyExpire(e logEntry, locationId string) error {
+	if !f.expiry.isExpired(locationId, e.timestamp) {
+		return ErrLocationNotExpired
+	}
+	return f.applyDelete(e, locationId)
+}
+
+func (f *fsm) applyUpdate(e logEntry, locationId string, location ds.Position, data map[string]interface{}, ttl int) error {
+	if err := f.q.Update(locationId, location, data, e.timestamp); err != nil {
+		return err
+	}
+	if ttl > 0 {
+		f.expiry.set(locationId, ttl, e.timestamp)
+	}
+	f.history.record(locationId, location, e.timestamp)
+	f.geofences.track(e, locationId, location)
 	return nil
 }
 
-func (f *fsm) applyInsert(locationId string, location ds.Position, data map[string]interface{}) interface{} {
-	f.q.Insert(locationId, location, data)
+func (f *fsm) applyUpdateLocation(e logEntry, locationId string, location ds.Position, refreshTTL bool) error {
+	if err := f.q.UpdateLocation(locationId, location, e.timestamp); err != nil {
+		return err
+	}
+	if refreshTTL {
+		f.expiry.refresh(locationId, e.timestamp)
+	}
+	f.history.record(locationId, location, e.timestamp)
+	f.geofences.track(e, locationId, location)
+	return nil
+}
+
+func (f *fsm) applyUpdateData(e logEntry, locationId string, data map[string]interface{}) error {
+	return f.q.UpdateData(locationId, data, e.timestamp)
+}
+
+func (f *fsm) applySetHistory(e logEntry, locationId string, size int) error {
+	if size < 0 || size > maxHistorySize {
+		return quadrilleError.ErrInvalidHistorySize
+	}
+	leaf, err := f.q.Get(locationId)
+	if err != nil {
+		return err
+	}
+	f.history.enable(locationId, size, leaf.GetLocation(), e.timestamp)
 	return nil
 }
 
-func (f *fsm) applyDelete(key string) error {
-	return f.q.Delete(key)
+func (f *fsm) applySetGeofence(e logEntry, fence *ds.Geofence) error {
+	if fence == nil {
+		return quadrilleError.ErrInvalidGeofence
+	}
+	if err := fence.Validate(); err != nil {
+		return err
+	}
+	var inside []ds.QuadTreeNeighborResult
+	if fence.IsCircular() {
+		inside = f.q.GetNearbyLocations(*fence.Center, fence.Radius, math.MaxInt32, nil, 0)
+	} else {
+		inside = f.q.GetLocationsInPolygon(fence.Polygons, math.MaxInt32)
+	}
+	insideLocationIDs := make([]string, 0, len(inside))
+	for _, result := range inside {
+		insideLocationIDs = append(insideLocationIDs, result.Leaf.GetLocationID())
+	}
+	f.geofences.set(e, *fence, insideLocationIDs)
+	return nil
 }
 
-func (f *fsm) applyUpdate(locationId string, location ds.Position, data map[string]interface{}) error {
-	return f.q.Update(locationId, location, data)
+func (f *fsm) applySetShape(e logEntry, shape *ds.Shape) error {
+	if shape == nil {
+		return quadrilleError.ErrInvalidShape
+	}
+	return f.q.SetShape(*shape, e.timestamp)
 }
 
-func (f *fsm) applyUpdateLocation(locationId string, location ds.Position) error {
-	return f.q.UpdateLocation(locationId, location)
+func (f *fsm) applyDeleteShape(id string) error {
+	return f.q.DeleteShape(id)
 }
 
-func (f *fsm) applyUpdateData(locationId string, data map[string]interface{}) error {
-	return f.q.UpdateData(locationId, data)
+func (f *fsm) applyDeleteGeofence(id string) error {
+	f.geofences.delete(id)
+	return nil
 }
 
 type fsmSnapshot struct {
-	store map[string]ds.QuadTreeLeaf
+	state snapshotState
 }
 
 func (f *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
 	err := func() error {
 		// Encode data.
-		b, err := json.Marshal(f.store)
+		b, err := json.Marshal(f.state)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"errors"
+	"github.com/quadrille/quadrille/core/ds"
+	"strings"
+	"sync"
+)
+
+//Number of most recently applied commands retained by each node for watchers resuming from an index
+const changeLogBufferSize = 10000
+
+//Number of events buffered for a watcher before it is considered to be lagging and is dropped
+const watcherBufferSize = 1024
+
+var (
+	ErrWatchIndexUnavailable = errors.New("changes from the requested index are no longer available, resync and watch from a newer index")
+	ErrWatcherLagging        = errors.New("watcher was dropped as it could not keep up with changes, resume from the last received index")
+	ErrWatchReset            = errors.New("store was restored from a snapshot, resync and watch from a newer index")
+	ErrInvalidWatchRegion    = errors.New("watch region needs minLat not above maxLat and cannot cross the antimeridian")
+)
+
+// ChangeEvent is emitted for every command applied to the store.
+type ChangeEvent struct {
+	Index     uint64  `json:"index"`
+	Timestamp int64   `json:"ts"`
+	Command   Command `json:"command"`
+
+	positions []ds.Position //Positions of the location before and after the command, used for region filtering
+}
+
+// WatchOptions restrict the changes delivered to a watcher. Changes are delivered from FromIndex when it is
+// greater than 0, otherwise only the changes applied after the watch started are delivered.
+type WatchOptions struct {
+	FromIndex uint64
+	Prefix    string       //Only deliver changes to locations whose location_id starts with Prefix
+	Region    ds.Rectangle //Only deliver changes to locations which were or are within Region
+}
+
+//NewWatchRegion returns the region between the south west and north east corners to restrict a watch to.
+//Regions crossing the antimeridian are rejected, as the region would otherwise match its complement.
+func NewWatchRegion(sw, ne *ds.Position) (ds.Rectangle, error) {
+	if sw.Lat() > ne.Lat() || sw.Long() > ne.Long() {
+		return nil, ErrInvalidWatchRegion
+	}
+	return ds.NewRectangle(sw, ne), nil
+}
+
+func newChangeEvent(e logEntry, c Command, before, after *ds.Position) ChangeEvent {
+	event := ChangeEvent{Index: e.index, Timestamp: e.timestamp, Command: c}
+	event.Command.Timestamp = e.timestamp
+	for _, position := range []*ds.Position{before, after} {
+		if position != nil {
+			event.positions = append(event.positions, *position)
+		}
+	}
+	return event
+}
+
+func (o WatchOptions) matches(e ChangeEvent) bool {
+	if o.Prefix != "" && (e.Command.LocationID == "" || !strings.HasPrefix(e.Command.LocationID, o.Prefix)) {
+		return false
+	}
+	if o.Region != nil {
+		for _, position := range e.positions {
+			if position.IsWithin(o.Region) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Watcher delivers change events on Events() until it is closed or dropped. Once the channel is closed, Err
+// reports why the watch ended.
+type Watcher struct {
+	events  chan ChangeEvent
+	live    chan ChangeEvent
+	done    chan struct{}
+	options WatchOptions
+	hub     *watchHub
+
+	errMtx sync.Mutex
+	err    error
+	once   sync.Once
+}
+
+func (w *Watcher) Events() <-chan ChangeEvent {
+	return w.events
+}
+
+func (w *Watcher) Err() error {
+	w.errMtx.Lock()
+	defer w.errMtx.Unlock()
+	return w.err
+}
+
+// Close stops the watcher. It is safe to call Close more than once.
+func (w *Watcher) Close() {
+	w.hub.unsubscribe(w, nil)
+}
+
+func (w *Watcher) stop(err error) {
+	w.once.Do(func() {
+		w.errMtx.Lock()
+		w.err = err
+		w.errMtx.Unlock()
+		close(w.done)
+	})
+}
+
+//Delivers the replayed events followed by the live ones until the watcher is stopped
+func (w *Watcher) run(replay []ChangeEvent) {
+	defer close(w.events)
+	for _, e := range replay {
+		select {
+		case w.events <- e:
+		case <-w.done:
+			return
+		}
+	}
+	for {
+		select {
+		case e := <-w.live:
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+type watchHub struct {
+	mtx       sync.Mutex
+	changes   []ChangeEvent
+	lastIndex uint64
+	watchers  map[*Watcher]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: map[*Watcher]struct{}{}}
+}
+
+func (h *watchHub) subscribe(options WatchOptions) (*Watcher, error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	replay := []ChangeEvent{}
+	if options.FromIndex > 0 && options.FromIndex <= h.lastIndex {
+		if len(h.changes) == 0 || options.FromIndex < h.changes[0].Index {
+			return nil, ErrWatchIndexUnavailable
+		}
+		for _, e := range h.changes {
+			if e.Index >= options.FromIndex && options.matches(e) {
+				replay = append(replay, e)
+			}
+		}
+	}
+	w := &Watcher{
+		events:  make(chan ChangeEvent),
+		live:    make(chan ChangeEvent, watcherBufferSize),
+		done:    make(chan struct{}),
+		options: options,
+		hub:     h,
+	}
+	h.watchers[w] = struct{}{}
+	go w.run(replay)
+	return w, nil
+}
+
+func (h *watchHub) unsubscribe(w *Watcher, err error) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	delete(h.watchers, w)
+	w.stop(err)
+}
+
+func (h *watchHub) publish(e ChangeEvent) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.lastIndex = e.Index
+	h.changes = append(h.changes, e)
+	//Re-slices rather than copies the retained changes, compacting them only once the array exceeds twice the buffer
+	if overflow := len(h.changes) - changeLogBufferSize; overflow > 0 {
+		h.changes = h.changes[overflow:]
+	}
+	if cap(h.changes) > 2*changeLogBufferSize {
+		h.changes = append(make([]ChangeEvent, 0, 2*changeLogBufferSize), h.changes...)
+	}
+	for w := range h.watchers {
+		if !w.options.matches(e) {
+			continue
+		}
+		select {
+		case w.live <- e:
+		default:
+			delete(h.watchers, w)
+			w.stop(ErrWatcherLagging)
+		}
+	}
+}
+
+//reset discards the retained changes and ends all watches, as the state has jumped to a snapshot
+func (h *watchHub) reset() {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.changes = nil
+	h.lastIndex = 0
+	for w := range h.watchers {
+		delete(h.watchers, w)
+		w.stop(ErrWatchReset)
+	}
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"github.com/quadrille/quadrille/core/ds"
+	"testing"
+	"time"
+)
+
+func receiveEvents(t *testing.T, watcher *Watcher, count int) []ChangeEvent {
+	events := []ChangeEvent{}
+	for len(events) < count {
+		select {
+		case e := <-watcher.Events():
+			events = append(events, e)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %d events, got %v", count, events)
+		}
+	}
+	return events
+}
+
+func TestWatch(t *testing.T) {
+	s := New("", "").(*store)
+	f := (*fsm)(s)
+	applyCommands(t, f, 1, Command{Op: string(OperationInsert), LocationID: "cab-1", Lat: 12.97, Long: 77.59, Timestamp: 1000})
+	applyCommands(t, f, 2, Command{Op: string(OperationInsert), LocationID: "bus-1", Lat: 12.97, Long: 77.59, Timestamp: 2000})
+
+	all, err := s.Watch(WatchOptions{FromIndex: 1})
+	if err != nil {
+		t.Fatalf("Expected no error, got %s", err.Error())
+	}
+	defer all.Close()
+	cabs, _ := s.Watch(WatchOptions{Prefix: "cab-"})
+	defer cabs.Close()
+	region, _ := s.Watch(WatchOptions{Region: ds.NewRectangle(ds.NewPosition(12.9, 77.5), ds.NewPosition(13, 77.6))})
+	defer region.Close()
+
+	applyCommands(t, f, 3, Command{Op: string(OperationUpdateLocation), LocationID: "bus-1", Lat: 28.61, Long: 77.20, Timestamp: 3000})
+	applyCommands(t, f, 4, Command{Op: string(OperationDelete), LocationID: "cab-1", Timestamp: 4000})
+	//Failed commands are not published
+	applyCommands(t, f, 5, Command{Op: string(OperationDelete), LocationID: "cab-2", Timestamp: 5000})
+
+	events := receiveEvents(t, all, 4)
+	for i, e := range events {
+		if e.Index != uint64(i+1) {
+			t.Fatalf("Expected event %d to have index %d, got %d", i, i+1, e.Index)
+		}
+	}
+	if events := receiveEvents(t, cabs, 1); events[0].Index != 4 {
+		t.Fatalf("Expected only the delete of cab-1, got %v", events)
+	}
+	//The bus moving out of the region and the deleted cab's last position are both matched
+	if events := receiveEvents(t, region, 2); events[0].Index != 3 || events[1].Index != 4 {
+		t.Fatalf("Expected the changes at index 3 and 4, got %v", events)
+	}
+
+	s.watchers.reset()
+	if _, ok := <-all.Events(); ok || all.Err() != ErrWatchReset {
+		t.Fatalf("Expected the watch to end with ErrWatchReset, got %v", all.Err())
+	}
+	applyCommands(t, f, 6, Command{Op: string(OperationInsert), LocationID: "cab-3", Lat: 12.97, Long: 77.59, Timestamp: 6000})
+	if _, err := s.Watch(WatchOptions{FromIndex: 2}); err != ErrWatchIndexUnavailable {
+		t.Fatalf("Expected ErrWatchIndexUnavailable, got %v", err)
+	}
+}
+
+func TestWatchHubRetainsChanges(t *testing.T) {
+	h := newWatchHub()
+	for i := uint64(1); i <= 3*changeLogBufferSize; i++ {
+		h.publish(ChangeEvent{Index: i})
+		if cap(h.changes) > 2*changeLogBufferSize {
+			t.Fatalf("Expected at most %d changes to be held onto, got %d", 2*changeLogBufferSize, cap(h.changes))
+		}
+	}
+	if len(h.changes) != changeLogBufferSize || h.changes[0].Index != 2*changeLogBufferSize+1 {
+		t.Fatalf("Expected the %d most recent changes, got %d from index %d", changeLogBufferSize, len(h.changes), h.changes[0].Index)
+	}
+}
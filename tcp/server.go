@@ -44,13 +44,15 @@ func (srv *service) Start() error {
 				log.Println(err)
 				os.Exit(100)
 			}
-			go handleConnection(c, quadrilleTCPService)
+			go handleConnection(c, quadrilleTCPService, srv.store)
 		}
 	}()
 	return nil
 }
 
-func handleConnection(c net.Conn, service opt.QuadrilleService) {
+func handleConnection(c net.Conn, service opt.QuadrilleService, s store.Store) {
+	watches := newConnectionWatches(c, s)
+	defer watches.closeAll()
 	for {
 		netData, err := bufio.NewReader(c).ReadString('\n')
 		if err != nil {
@@ -66,6 +68,8 @@ func handleConnection(c net.Conn, service opt.QuadrilleService) {
 		cmdParts := strings.Split(cmdLine, "::")
 		if len(cmdParts) < 2 {
 			c.Write([]byte(fmt.Sprintf("%s::ERROR:%s\n", cmdParts[0], "quadrille protocol expects format queryid::command")))
+		} else if isWatchCommand(cmdParts[1]) {
+			watches.handle(cmdParts[0], cmdParts[1])
 		} else {
 			go func() {
 				//	fmt.Println(cmdParts[0])
@@ -3,6 +3,7 @@ package tcp
 import (
 	"encoding/json"
 	"github.com/quadrille/quadrille/core/ds"
+	"github.com/quadrille/quadrille/http/types"
 	"github.com/quadrille/quadrille/opt"
 	"github.com/quadrille/quadrille/replication/store"
 )
@@ -25,14 +26,23 @@ func transformResponse(responseObj interface{}, e error) (body string, err error
 	return body, e
 }
 
-func getResponseObjectFromQuadtreeLeaf(leaf ds.QuadTreeLeaf) map[string]interface{} {
-	return map[string]interface{}{"data": leaf.GetLocationID(), "lat": leaf.GetLocation().Lat(), "lon": leaf.GetLocation().Long()}
+//Returns the leaf as written in responses, along with the parts of its data selected by the projection under "fields"
+//if one was given
+func getResponseObjectFromQuadtreeLeaf(leaf ds.QuadTreeLeaf, fields ds.Projection) map[string]interface{} {
+	response := map[string]interface{}{"data": leaf.GetLocationID(), "lat": leaf.GetLocation().Lat(), "lon": leaf.GetLocation().Long(), "updated_at": leaf.UpdatedAt}
+	if fields != nil {
+		response["fields"] = fields.Apply(leaf.Data)
+	}
+	if alt := leaf.GetLocation().Alt(); alt != 0 {
+		response["alt"] = alt
+	}
+	return response
 }
 
-func (q quadrilleTCPClient) GetLocation(locationID string) (body string, err error) {
+func (q quadrilleTCPClient) GetLocation(locationID string, fields ds.Projection) (body string, err error) {
 	leaf, err := q.store.Get(locationID)
 	if err == nil {
-		return transformResponse(getResponseObjectFromQuadtreeLeaf(leaf), err)
+		return transformResponse(getResponseObjectFromQuadtreeLeaf(leaf, fields), err)
 	}
 	return
 }
@@ -42,18 +52,18 @@ func (q quadrilleTCPClient) DeleteLocation(locationID string) (body string, err
 	return
 }
 
-func (q quadrilleTCPClient) Insert(locationID string, position ds.Position, data map[string]interface{}) (body string, err error) {
-	err = q.store.Insert(locationID, position, data)
+func (q quadrilleTCPClient) Insert(locationID string, position ds.Position, data map[string]interface{}, ttl int) (body string, err error) {
+	err = q.store.Insert(locationID, position, data, ttl)
 	return
 }
 
-func (q quadrilleTCPClient) Update(locationID string, position ds.Position, data map[string]interface{}) (body string, err error) {
-	err = q.store.Update(locationID, position, data)
+func (q quadrilleTCPClient) Update(locationID string, position ds.Position, data map[string]interface{}, ttl int) (body string, err error) {
+	err = q.store.Update(locationID, position, data, ttl)
 	return
 }
 
-func (q quadrilleTCPClient) UpdateLocation(locationID string, position ds.Position) (body string, err error) {
-	err = q.store.UpdateLocation(locationID, position)
+func (q quadrilleTCPClient) UpdateLocation(locationID string, position ds.Position, refreshTTL bool) (body string, err error) {
+	err = q.store.UpdateLocation(locationID, position, refreshTTL)
 	return
 }
 
@@ -67,15 +77,166 @@ func (q quadrilleTCPClient) BulkWrite(commands []store.Command) (body string, er
 	return
 }
 
-func (q quadrilleTCPClient) Neighbors(location ds.Position, radius, limit int) (body string, err error) {
-	neighbors := q.store.GetNeighbors(location, radius, limit)
+func getResponseObjectFromNeighborResults(neighbors []ds.QuadTreeNeighborResult, fields ds.Projection) []map[string]interface{} {
 	neighborsTmp := make([]map[string]interface{}, 0)
 	for _, neighbor := range neighbors {
-		neighborResponse := getResponseObjectFromQuadtreeLeaf(neighbor.Leaf)
+		neighborResponse := getResponseObjectFromQuadtreeLeaf(neighbor.Leaf, fields)
 		neighborResponse["distance"] = neighbor.Distance
 		neighborsTmp = append(neighborsTmp, neighborResponse)
 	}
-	return transformResponse(neighborsTmp, nil)
+	return neighborsTmp
+}
+
+func (q quadrilleTCPClient) Neighbors(location ds.Position, radius, limit int, filterExpr string, maxAge int, altitude ds.AltitudeQuery, fields ds.Projection) (body string, err error) {
+	var filter ds.Filter
+	if filterExpr != "" {
+		if filter, err = ds.ParseFilter(filterExpr); err != nil {
+			return
+		}
+	}
+	neighbors := q.store.GetNeighbors(location, radius, limit, filter, maxAge, altitude)
+	return transformResponse(getResponseObjectFromNeighborResults(neighbors, fields), nil)
+}
+
+func (q quadrilleTCPClient) Nearest(location ds.Position, k, maxDistance int, fields ds.Projection) (body string, err error) {
+	nearest := q.store.GetNearest(location, k, maxDistance)
+	return transformResponse(getResponseObjectFromNeighborResults(nearest, fields), nil)
+}
+
+func (q quadrilleTCPClient) Within(sw, ne ds.Position, limit, maxAge int, fields ds.Projection) (body string, err error) {
+	locations := q.store.GetLocationsInBox(sw, ne, limit, maxAge)
+	return transformResponse(getResponseObjectFromNeighborResults(locations, fields), nil)
+}
+
+func (q quadrilleTCPClient) Polygon(polygons []ds.Polygon, limit int, fields ds.Projection) (body string, err error) {
+	locations := q.store.GetLocationsInPolygon(polygons, limit)
+	return transformResponse(getResponseObjectFromNeighborResults(locations, fields), nil)
+}
+
+func (q quadrilleTCPClient) CountNeighbors(location ds.Position, radius int, filterExpr string, maxAge int, altitude ds.AltitudeQuery, limit int) (body string, err error) {
+	var filter ds.Filter
+	if filterExpr != "" {
+		if filter, err = ds.ParseFilter(filterExpr); err != nil {
+			return
+		}
+	}
+	count := q.store.CountNeighbors(location, radius, filter, maxAge, altitude, limit)
+	return transformResponse(map[string]int{"count": count}, nil)
+}
+
+func (q quadrilleTCPClient) CountWithin(sw, ne ds.Position, maxAge, limit int) (body string, err error) {
+	count := q.store.CountLocationsInBox(sw, ne, maxAge, limit)
+	return transformResponse(map[string]int{"count": count}, nil)
+}
+
+func (q quadrilleTCPClient) CountPolygon(polygons []ds.Polygon, limit int) (body string, err error) {
+	count := q.store.CountLocationsInPolygon(polygons, limit)
+	return transformResponse(map[string]int{"count": count}, nil)
+}
+
+func (q quadrilleTCPClient) Aggregate(sw, ne ds.Position, depth int, field string) (body string, err error) {
+	return transformResponse(q.store.Aggregate(sw, ne, depth, field), nil)
+}
+
+func (q quadrilleTCPClient) Cluster(sw, ne ds.Position, zoom, samples int) (body string, err error) {
+	return transformResponse(q.store.GetClusters(sw, ne, zoom, samples), nil)
+}
+
+func (q quadrilleTCPClient) Geohash(geohash string, limit int, fields ds.Projection) (body string, err error) {
+	locations, err := q.store.GetLocationsInGeohash(geohash, limit)
+	if err == nil {
+		return transformResponse(getResponseObjectFromNeighborResults(locations, fields), err)
+	}
+	return
+}
+
+func (q quadrilleTCPClient) Corridor(route []ds.Position, buffer, limit int, fields ds.Projection) (body string, err error) {
+	results := q.store.GetLocationsAlongRoute(route, buffer, limit)
+	response := make([]map[string]interface{}, 0, len(results))
+	for _, result := range results {
+		resultResponse := getResponseObjectFromQuadtreeLeaf(result.Leaf, fields)
+		resultResponse["distance"] = result.Distance
+		resultResponse["distance_along_route"] = result.DistanceAlongRoute
+		response = append(response, resultResponse)
+	}
+	return transformResponse(response, nil)
+}
+
+func (q quadrilleTCPClient) DistanceMatrix(origins, destinations []ds.MatrixPoint) (body string, err error) {
+	distances, err := q.store.DistanceMatrix(origins, destinations)
+	if err != nil {
+		return
+	}
+	return transformResponse(map[string][][]float64{"distances": distances}, nil)
+}
+
+func (q quadrilleTCPClient) SetGeofence(fence ds.Geofence) (body string, err error) {
+	err = q.store.SetGeofence(fence)
+	return
+}
+
+func (q quadrilleTCPClient) GetGeofence(id string) (body string, err error) {
+	fence, err := q.store.GetGeofence(id)
+	if err == nil {
+		return transformResponse(types.NewGeofence(fence), err)
+	}
+	return
+}
+
+func (q quadrilleTCPClient) DeleteGeofence(id string) (body string, err error) {
+	err = q.store.DeleteGeofence(id)
+	return
+}
+
+func (q quadrilleTCPClient) Geofences() (body string, err error) {
+	return transformResponse(types.PrepareGeofences(q.store.GetGeofences()), nil)
+}
+
+func (q quadrilleTCPClient) SetShape(shape ds.Shape) (body string, err error) {
+	err = q.store.SetShape(shape)
+	return
+}
+
+func (q quadrilleTCPClient) GetShape(id string) (body string, err error) {
+	shape, err := q.store.GetShape(id)
+	if err == nil {
+		return transformResponse(types.NewShape(shape), err)
+	}
+	return
+}
+
+func (q quadrilleTCPClient) DeleteShape(id string) (body string, err error) {
+	err = q.store.DeleteShape(id)
+	return
+}
+
+func (q quadrilleTCPClient) NearbyShapes(location ds.Position, radius, limit int) (body string, err error) {
+	return transformResponse(types.PrepareShapeResults(q.store.GetShapesNearby(location, radius, limit)), nil)
+}
+
+func (q quadrilleTCPClient) Containing(location ds.Position, withData bool) (body string, err error) {
+	return transformResponse(types.PrepareContainingShapes(q.store.GetShapesContaining(location), withData), nil)
+}
+
+func (q quadrilleTCPClient) GeofenceEvents(since uint64, limit int) (body string, err error) {
+	return transformResponse(q.store.GetGeofenceEvents(since, limit), nil)
+}
+
+func (q quadrilleTCPClient) SetHistory(locationID string, size int) (body string, err error) {
+	err = q.store.SetHistory(locationID, size)
+	return
+}
+
+func (q quadrilleTCPClient) Trajectory(locationID string, from, to int64) (body string, err error) {
+	trajectory, err := q.store.GetTrajectory(locationID, from, to)
+	if err == nil {
+		return transformResponse(trajectory, err)
+	}
+	return
+}
+
+func (q quadrilleTCPClient) Stats() (body string, err error) {
+	return transformResponse(q.store.Stats(), nil)
 }
 
 func (q quadrilleTCPClient) IsLeader() (body string, err error) {
@@ -0,0 +1,105 @@
+package tcp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/quadrille/quadrille/opt"
+	"github.com/quadrille/quadrille/replication/store"
+	"net"
+	"strings"
+	"sync"
+)
+
+var ErrUnknownWatch = errors.New("no watch was started with the given query id")
+
+//connectionWatches tracks the watches started on a connection, keyed by the query id which started them
+type connectionWatches struct {
+	mtx      sync.Mutex
+	conn     net.Conn
+	store    store.Store
+	watchers map[string]*store.Watcher
+}
+
+func newConnectionWatches(conn net.Conn, s store.Store) *connectionWatches {
+	return &connectionWatches{conn: conn, store: s, watchers: map[string]*store.Watcher{}}
+}
+
+func isWatchCommand(cmd string) bool {
+	cmdName := strings.Split(cmd, " ")[0]
+	return cmdName == opt.Watch || cmdName == opt.Unwatch
+}
+
+//handle executes a watch or unwatch command. A watch replies with ok followed by one line per change event,
+//all prefixed with the query id of the watch, until it is unwatched or fails.
+func (cw *connectionWatches) handle(queryID, cmd string) {
+	cmdParts := strings.Split(cmd, " ")
+	if err := opt.NewValidator(cmdParts[0])(cmdParts); err != nil {
+		cw.writeErr(queryID, err)
+		return
+	}
+	if cmdParts[0] == opt.Unwatch {
+		if err := cw.unwatch(cmdParts[1]); err != nil {
+			cw.writeErr(queryID, err)
+			return
+		}
+		cw.write(queryID, "ok")
+		return
+	}
+	options, _ := opt.ParseWatchArgs(cmdParts)
+	watcher, err := cw.store.Watch(options)
+	if err != nil {
+		cw.writeErr(queryID, err)
+		return
+	}
+	cw.mtx.Lock()
+	if existing, ok := cw.watchers[queryID]; ok {
+		existing.Close()
+	}
+	cw.watchers[queryID] = watcher
+	cw.mtx.Unlock()
+	cw.write(queryID, "ok")
+	go func() {
+		for e := range watcher.Events() {
+			eventStr, _ := json.Marshal(e)
+			cw.write(queryID, string(eventStr))
+		}
+		if err := watcher.Err(); err != nil {
+			cw.writeErr(queryID, err)
+		}
+		cw.mtx.Lock()
+		if cw.watchers[queryID] == watcher {
+			delete(cw.watchers, queryID)
+		}
+		cw.mtx.Unlock()
+	}()
+}
+
+func (cw *connectionWatches) unwatch(queryID string) error {
+	cw.mtx.Lock()
+	defer cw.mtx.Unlock()
+	watcher, ok := cw.watchers[queryID]
+	if !ok {
+		return ErrUnknownWatch
+	}
+	delete(cw.watchers, queryID)
+	watcher.Close()
+	return nil
+}
+
+func (cw *connectionWatches) closeAll() {
+	cw.mtx.Lock()
+	defer cw.mtx.Unlock()
+	for queryID, watcher := range cw.watchers {
+		delete(cw.watchers, queryID)
+		watcher.Close()
+	}
+}
+
+func (cw *connectionWatches) write(queryID, body string) {
+	cw.conn.Write([]byte(fmt.Sprintf("%s::%s\n", queryID, body)))
+}
+
+func (cw *connectionWatches) writeErr(queryID string, err error) {
+	cw.conn.Write([]byte(fmt.Sprintf("%s::ERROR:%s\n", queryID, err.Error())))
+}